@@ -0,0 +1,77 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"groupware-gin/helpers"
+)
+
+var (
+	ErrNotFound   = errors.New("this file does not exist")
+	ErrInvalidKey = errors.New("invalid file key")
+)
+
+// BlobInfo describes a stored file
+type BlobInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	ETag        string // without quotes, may be empty
+}
+
+// BlobStore keeps the uploaded files by keys like users/<key>/<uuid>.jpg,
+// that are stored in the documents as they are.
+// Get and Stat return ErrNotFound for a missing file,
+// but the deletes succeed on missing files.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, *BlobInfo, error)
+	Stat(ctx context.Context, key string) (*BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes all files under the directory like users/<key>
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// NewBlobStore builds the store selected by STORAGE_DRIVER (local or s3)
+func NewBlobStore() (BlobStore, error) {
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "storage"
+		}
+		return NewLocalStore(dir), nil
+	case "s3":
+		useSSL, err := helpers.EnvBool("S3_USE_SSL", true)
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Store(context.Background(), S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    useSSL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", os.Getenv("STORAGE_DRIVER"))
+	}
+}
+
+// cleanKey rejects the keys escaping the root like ../foo or /foo
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if key == "" || cleaned == "." || strings.HasPrefix(cleaned, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,133 @@
+package blobs
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testBlobStore runs the same checks on every driver,
+// so the local disk and S3 behave alike for the controllers
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+
+	put := func(key string, content string) {
+		t.Helper()
+		err := store.Put(ctx, key, strings.NewReader(content), int64(len(content)), "image/jpeg")
+		if err != nil {
+			t.Fatalf("Put(%q) returned %v", key, err)
+		}
+	}
+	exists := func(key string) bool {
+		t.Helper()
+		_, err := store.Stat(ctx, key)
+		if err == ErrNotFound {
+			return false
+		} else if err != nil {
+			t.Fatalf("Stat(%q) returned %v", key, err)
+		}
+		return true
+	}
+
+	t.Run("put and get", func(t *testing.T) {
+		put("users/1/avatar.jpg", "hello")
+		info, err := store.Stat(ctx, "users/1/avatar.jpg")
+		if err != nil {
+			t.Fatalf("Stat returned %v", err)
+		}
+		if info.Key != "users/1/avatar.jpg" || info.Size != 5 || info.ContentType != "image/jpeg" {
+			t.Errorf("Stat returned %+v", info)
+		}
+		if info.ModTime.IsZero() {
+			t.Errorf("Stat returned no ModTime")
+		}
+
+		file, info, err := store.Get(ctx, "users/1/avatar.jpg")
+		if err != nil {
+			t.Fatalf("Get returned %v", err)
+		}
+		defer file.Close()
+		content, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatalf("reading returned %v", err)
+		}
+		if string(content) != "hello" || info.Size != 5 {
+			t.Errorf("Get returned %q with %+v", content, info)
+		}
+	})
+
+	t.Run("put overwrites", func(t *testing.T) {
+		put("users/1/avatar.jpg", "hello again")
+		info, err := store.Stat(ctx, "users/1/avatar.jpg")
+		if err != nil {
+			t.Fatalf("Stat returned %v", err)
+		}
+		if info.Size != 11 {
+			t.Errorf("Stat returned the size %d, want 11", info.Size)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, _, err := store.Get(ctx, "users/1/missing.jpg")
+		if err != ErrNotFound {
+			t.Errorf("Get returned %v, want ErrNotFound", err)
+		}
+		_, err = store.Stat(ctx, "users/1/missing.jpg")
+		if err != ErrNotFound {
+			t.Errorf("Stat returned %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		put("users/3/avatar.jpg", "bye")
+		err := store.Delete(ctx, "users/3/avatar.jpg")
+		if err != nil {
+			t.Fatalf("Delete returned %v", err)
+		}
+		if exists("users/3/avatar.jpg") {
+			t.Errorf("the file exists after Delete")
+		}
+		err = store.Delete(ctx, "users/3/avatar.jpg")
+		if err != nil {
+			t.Errorf("Delete of a missing file returned %v", err)
+		}
+	})
+
+	t.Run("delete prefix", func(t *testing.T) {
+		put("users/2/avatar.jpg", "a")
+		put("users/2/thumbnails/64.jpg", "b")
+		put("users/20/avatar.jpg", "c")
+		err := store.DeletePrefix(ctx, "users/2")
+		if err != nil {
+			t.Fatalf("DeletePrefix returned %v", err)
+		}
+		if exists("users/2/avatar.jpg") || exists("users/2/thumbnails/64.jpg") {
+			t.Errorf("the files under the prefix exist after DeletePrefix")
+		}
+		if !exists("users/20/avatar.jpg") {
+			t.Errorf("DeletePrefix removed a file of another directory with the same beginning")
+		}
+		err = store.DeletePrefix(ctx, "users/missing")
+		if err != nil {
+			t.Errorf("DeletePrefix of a missing directory returned %v", err)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		for _, key := range []string{"", ".", "..", "../avatar.jpg", "/avatar.jpg", "users/../../avatar.jpg"} {
+			err := store.Put(ctx, key, strings.NewReader("x"), 1, "image/jpeg")
+			if err != ErrInvalidKey {
+				t.Errorf("Put(%q) returned %v, want ErrInvalidKey", key, err)
+			}
+			_, err = store.Stat(ctx, key)
+			if err != ErrInvalidKey {
+				t.Errorf("Stat(%q) returned %v, want ErrInvalidKey", key, err)
+			}
+		}
+	})
+}
+
+func TestLocalStore(t *testing.T) {
+	testBlobStore(t, NewLocalStore(t.TempDir()))
+}
@@ -0,0 +1,150 @@
+package blobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config connects to AWS S3 or a compatible server like MinIO
+type S3Config struct {
+	Endpoint  string // like s3.amazonaws.com or localhost:9000
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// S3Store keeps the files as the objects of a bucket
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store connects to the server, and creates the bucket if missing
+func NewS3Store(ctx context.Context, config S3Config) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3_ENDPOINT and S3_BUCKET are required")
+	}
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	found, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &S3Store{client: client, bucket: config.Bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+// Get stats the object first, because GetObject reports a missing object
+// only on the first read
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadSeekCloser, *BlobInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, info.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+	return object, info, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (*BlobInfo, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return &BlobInfo{
+		Key:         key,
+		Size:        object.Size,
+		ContentType: object.ContentType,
+		ModTime:     object.LastModified.UTC(),
+		ETag:        strings.Trim(object.ETag, `"`),
+	}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Store) DeletePrefix(ctx context.Context, prefix string) error {
+	prefix, err := cleanKey(prefix)
+	if err != nil {
+		return err
+	}
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix + "/",
+		Recursive: true,
+	})
+	// the listing errors come with the objects
+	var listErr error
+	filtered := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(filtered)
+		for object := range objects {
+			if object.Err != nil {
+				listErr = object.Err
+				continue
+			}
+			select {
+			case filtered <- object:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	for result := range s.client.RemoveObjects(ctx, s.bucket, filtered, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			err = result.Err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return listErr
+}
+
+func s3Error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrNotFound
+	default:
+		return err
+	}
+}
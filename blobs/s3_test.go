@@ -0,0 +1,55 @@
+package blobs
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestS3Store runs against a real server, and is skipped without S3_TEST_ENDPOINT.
+// start MinIO for it like
+//
+//	docker run --rm -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 go test ./blobs
+//
+// the credentials default to minioadmin, and every run uses a new bucket
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	config := S3Config{
+		Endpoint:  endpoint,
+		AccessKey: envOr("S3_TEST_ACCESS_KEY", "minioadmin"),
+		SecretKey: envOr("S3_TEST_SECRET_KEY", "minioadmin"),
+		Bucket:    "groupware-test-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		Region:    os.Getenv("S3_TEST_REGION"),
+		UseSSL:    os.Getenv("S3_TEST_USE_SSL") == "true",
+	}
+	ctx := context.Background()
+	store, err := NewS3Store(ctx, config)
+	if err != nil {
+		t.Fatalf("NewS3Store returned %v", err)
+	}
+	t.Cleanup(func() {
+		err := store.DeletePrefix(ctx, "users")
+		if err == nil {
+			err = store.client.RemoveBucket(ctx, config.Bucket)
+		}
+		if err != nil {
+			t.Logf("removing the bucket %s returned %v", config.Bucket, err)
+		}
+	})
+
+	testBlobStore(t, store)
+}
+
+func envOr(name string, fallback string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"groupware-gin/models"
+	"groupware-gin/repositories"
+)
+
+var errPermissionDenied = errors.New("permission denied")
+
+// RequireSystemAdmin rejects the request unless current user is a system admin,
+// so it must be placed after Authenticate
+func (s *Server) RequireSystemAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, err := s.isSystemAdmin(context.Background(), c.GetString("user_key"))
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if !admin {
+			abortWithError(c, http.StatusForbidden, errPermissionDenied)
+			return
+		}
+		c.Next()
+	}
+}
+
+// system admins can manage every company,
+// and company admins can manage their own companies
+func (s *Server) canManageCompany(c *gin.Context, companyKey string) (bool, error) {
+	ctx := context.Background()
+	userKey := c.GetString("user_key")
+	admin, err := s.isSystemAdmin(ctx, userKey)
+	if err != nil || admin {
+		return admin, err
+	}
+	return s.Employment.IsCompanyAdmin(ctx, userKey, companyKey)
+}
+
+// system admins can manage every user,
+// and others can manage only themselves
+func (s *Server) canManageUser(c *gin.Context, userKey string) (bool, error) {
+	if c.GetString("user_key") == userKey {
+		return true, nil
+	}
+	return s.isSystemAdmin(context.Background(), c.GetString("user_key"))
+}
+
+func (s *Server) isSystemAdmin(ctx context.Context, userKey string) (bool, error) {
+	doc, err := s.Users.Get(ctx, userKey)
+	if err == repositories.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return doc.Role == models.RoleAdmin && doc.DeletedAt == nil, nil
+}
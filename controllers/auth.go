@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"groupware-gin/helpers"
+	"groupware-gin/models"
+	"groupware-gin/repositories"
+)
+
+type TokenResponse struct {
+	TokenType    string `json:"token_type"`
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int64  `json:"expires_in"` // in seconds
+	RefreshToken string `json:"refresh_token"`
+}
+
+/*
+ * POST /auth/login
+ *
+ * Issue tokens for the right email and password
+ */
+
+type LoginParams struct {
+	Email    string `json:"email" valid:"required,email"`
+	Password string `json:"password" valid:"required"`
+}
+
+func (s *Server) Login(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate payload
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	var params LoginParams
+	err := dec.Decode(&params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// find the user who is not trashed
+	users, _, err := s.Users.List(ctx, repositories.ListOptions{
+		Filter: []repositories.Condition{
+			{Field: "email", Operator: "eq", Value: strings.ToLower(params.Email)}, // stored in lower case
+		},
+		Limit: 1,
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if len(users) == 0 {
+		// take as long as a wrong password, so the time does not tell the email exists
+		helpers.VerifyPassword(s.Hasher, s.dummyPasswordHash(), params.Password)
+		abortWithError(c, http.StatusUnauthorized, errors.New("invalid credentials"))
+		return
+	}
+	key := users[0].Key
+
+	// check the password
+	ok, err := s.verifyUserPassword(ctx, key, params.Password)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		abortWithError(c, http.StatusUnauthorized, errors.New("invalid credentials"))
+		return
+	}
+
+	// make a result
+	result, _, err := s.issueTokens(ctx, key, uuid.New().String())
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+/*
+ * POST /auth/refresh
+ *
+ * Exchange a refresh token for new tokens
+ */
+
+type RefreshParams struct {
+	RefreshToken string `json:"refresh_token" valid:"required"`
+}
+
+func (s *Server) Refresh(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate payload
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	var params RefreshParams
+	err := dec.Decode(&params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// look up the token
+	doc, err := s.RefreshTokens.Get(ctx, helpers.HashRefreshToken(params.RefreshToken))
+	if err == repositories.ErrNotFound {
+		abortWithError(c, http.StatusUnauthorized, errors.New("invalid refresh token"))
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if doc.ReplacedBy != "" {
+		// this token was already used, so someone else may hold the chain
+		err = s.RefreshTokens.RevokeFamily(ctx, doc.Family)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		abortWithError(c, http.StatusUnauthorized, errors.New("invalid refresh token"))
+		return
+	}
+	if time.Now().After(doc.ExpiresAt) {
+		s.RefreshTokens.Delete(ctx, doc.Key)
+		abortWithError(c, http.StatusUnauthorized, errors.New("refresh token expired"))
+		return
+	}
+
+	// the user may be deleted after login
+	user, err := s.Users.Get(ctx, doc.UserKey)
+	if err == repositories.ErrNotFound || (err == nil && user.DeletedAt != nil) {
+		s.RefreshTokens.RevokeFamily(ctx, doc.Family)
+		abortWithError(c, http.StatusUnauthorized, errors.New("invalid refresh token"))
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// rotate the token
+	result, newKey, err := s.issueTokens(ctx, doc.UserKey, doc.Family)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	err = s.RefreshTokens.Replace(ctx, doc.Key, newKey)
+	if err == repositories.ErrConflict {
+		// another request has used this token at the same time
+		err = s.RefreshTokens.RevokeFamily(ctx, doc.Family)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		abortWithError(c, http.StatusUnauthorized, errors.New("invalid refresh token"))
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+/*
+ * POST /auth/logout
+ *
+ * Revoke a refresh token and the ones rotated with it
+ */
+
+func (s *Server) Logout(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate payload
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	var params RefreshParams
+	err := dec.Decode(&params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// perform an action
+	doc, err := s.RefreshTokens.Get(ctx, helpers.HashRefreshToken(params.RefreshToken))
+	if err != nil && err != repositories.ErrNotFound {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if err == nil {
+		err = s.RefreshTokens.RevokeFamily(ctx, doc.Family)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	c.JSON(http.StatusNoContent, "")
+}
+
+// Authenticate rejects the request without a valid access token,
+// otherwise the key of current user is available as "user_key"
+func (s *Server) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			abortWithError(c, http.StatusUnauthorized, errors.New("missing access token"))
+			return
+		}
+		key, err := s.Tokens.ParseAccessToken(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, err)
+			return
+		}
+
+		// the user may be trashed after the token was issued
+		user, err := s.Users.Get(context.Background(), key)
+		if err == repositories.ErrNotFound || (err == nil && user.DeletedAt != nil) {
+			abortWithError(c, http.StatusUnauthorized, helpers.ErrInvalidToken)
+			return
+		} else if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.Set("user_key", key)
+		c.Next()
+	}
+}
+
+// AuthenticateOrSigned accepts a signed URL instead of the access token,
+// so the files can be linked from the tags like <img>
+func (s *Server) AuthenticateOrSigned() gin.HandlerFunc {
+	authenticate := s.Authenticate()
+	return func(c *gin.Context) {
+		signature := c.Query("signature")
+		if signature == "" {
+			authenticate(c)
+			return
+		}
+		err := s.URLs.Verify(c.Request.URL.Path, c.Query("expires"), signature)
+		if err != nil {
+			abortWithError(c, http.StatusForbidden, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// verify the password of a user, and upgrade the stored hash
+// when it was made by an old algorithm or with old settings
+func (s *Server) verifyUserPassword(ctx context.Context, key string, password string) (bool, error) {
+	stored, err := s.Users.Password(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	ok, rehash, err := helpers.VerifyPassword(s.Hasher, stored, password)
+	if err != nil || !ok {
+		return false, err
+	}
+	if rehash {
+		hash, err := s.Hasher.Hash(password)
+		if err != nil {
+			return true, err
+		}
+		_, err = s.Users.Update(ctx, key, "", repositories.UserPatch{
+			Password: &hash,
+		})
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// a hash made by the current hasher, to verify against when no user has the email
+func (s *Server) dummyPasswordHash() string {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = s.Hasher.Hash(uuid.New().String())
+	})
+	return s.dummyHash
+}
+
+func (s *Server) issueTokens(ctx context.Context, userKey string, family string) (*TokenResponse, string, error) {
+	accessToken, expiresAt, err := s.Tokens.SignAccessToken(userKey)
+	if err != nil {
+		return nil, "", err
+	}
+	refreshToken, hash, refreshExpiresAt, err := s.Tokens.NewRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+	err = s.RefreshTokens.Create(ctx, models.RefreshToken{
+		Key:       hash,
+		UserKey:   userKey,
+		Family:    family,
+		ExpiresAt: refreshExpiresAt,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &TokenResponse{
+		TokenType:    "Bearer",
+		AccessToken:  accessToken,
+		ExpiresIn:    int64(time.Until(expiresAt).Seconds()),
+		RefreshToken: refreshToken,
+	}, hash, nil
+}
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"groupware-gin/helpers"
+	"groupware-gin/models"
+	"groupware-gin/repositories"
+)
+
+func (ts *testServer) login(email string, password string) TokenResponse {
+	ts.t.Helper()
+	w := ts.request("POST", "/api/v1/auth/login", "", `{"email":"`+email+`","password":"`+password+`"}`)
+	expectStatus(ts.t, w, http.StatusOK)
+	var tokens TokenResponse
+	decodeBody(ts.t, w, &tokens)
+	return tokens
+}
+
+func (ts *testServer) refresh(refreshToken string) *TokenResponse {
+	w := ts.request("POST", "/api/v1/auth/refresh", "", `{"refresh_token":"`+refreshToken+`"}`)
+	if w.Code != http.StatusOK {
+		return nil
+	}
+	var tokens TokenResponse
+	decodeBody(ts.t, w, &tokens)
+	return &tokens
+}
+
+func TestLogin(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	trashed := ts.insertUser("Trashed", "trashed@example.com", models.RoleMember)
+	ts.trash("users", trashed)
+
+	t.Run("issues tokens", func(t *testing.T) {
+		tokens := ts.login("alice@example.com", testPassword)
+		if tokens.TokenType != "Bearer" || tokens.RefreshToken == "" || tokens.ExpiresIn <= 0 {
+			t.Errorf("got %+v", tokens)
+		}
+		subject, err := ts.Tokens.ParseAccessToken(tokens.AccessToken)
+		if err != nil || subject != key {
+			t.Errorf("the access token is for %q, %v", subject, err)
+		}
+	})
+
+	t.Run("ignores the case of email", func(t *testing.T) {
+		ts.login("Alice@Example.com", testPassword)
+	})
+
+	t.Run("rejects wrong credentials", func(t *testing.T) {
+		for _, body := range []string{
+			`{"email":"alice@example.com","password":"wrong password"}`,
+			`{"email":"nobody@example.com","password":"` + testPassword + `"}`,
+			`{"email":"trashed@example.com","password":"` + testPassword + `"}`,
+		} {
+			w := ts.request("POST", "/api/v1/auth/login", "", body)
+			expectError(t, w, http.StatusUnauthorized, "unauthorized")
+		}
+		// the unknown email is verified against a hash of the current settings too
+		if ts.dummyHash == "" || ts.Hasher.NeedsRehash(ts.dummyHash) {
+			t.Errorf("got the dummy hash %q", ts.dummyHash)
+		}
+	})
+
+	t.Run("validates payload", func(t *testing.T) {
+		w := ts.request("POST", "/api/v1/auth/login", "", `{"email":"alice"}`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+		w = ts.request("POST", "/api/v1/auth/login", "", `{"email":"alice@example.com","password":"x","extra":1}`)
+		expectStatus(t, w, http.StatusBadRequest)
+	})
+
+	t.Run("upgrades the old hash", func(t *testing.T) {
+		weak, _ := (&helpers.BcryptHasher{Cost: 5}).Hash(testPassword)
+		ts.insert("users", map[string]interface{}{
+			"name":     "Old",
+			"email":    "old@example.com",
+			"password": weak,
+			"role":     models.RoleMember,
+		})
+		ts.login("old@example.com", testPassword)
+		users := ts.store.Documents("users")
+		for _, user := range users {
+			if user["email"] == "old@example.com" && ts.Hasher.NeedsRehash(user["password"].(string)) {
+				t.Errorf("the hash is not upgraded")
+			}
+		}
+	})
+}
+
+func TestRefresh(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+
+	t.Run("rotates the token", func(t *testing.T) {
+		first := ts.login("alice@example.com", testPassword)
+		second := ts.refresh(first.RefreshToken)
+		if second == nil || second.RefreshToken == first.RefreshToken {
+			t.Fatalf("got %+v", second)
+		}
+		third := ts.refresh(second.RefreshToken)
+		if third == nil {
+			t.Fatalf("the rotated token is rejected")
+		}
+	})
+
+	t.Run("revokes the family on reuse", func(t *testing.T) {
+		first := ts.login("alice@example.com", testPassword)
+		second := ts.refresh(first.RefreshToken)
+		if second == nil {
+			t.Fatalf("the token is rejected")
+		}
+		w := ts.request("POST", "/api/v1/auth/refresh", "", `{"refresh_token":"`+first.RefreshToken+`"}`)
+		expectError(t, w, http.StatusUnauthorized, "unauthorized")
+		if ts.refresh(second.RefreshToken) != nil {
+			t.Errorf("the token rotated from the reused one still works")
+		}
+	})
+
+	t.Run("rejects an expired token", func(t *testing.T) {
+		token, hash, _, err := ts.Tokens.NewRefreshToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ts.RefreshTokens.Create(context.Background(), models.RefreshToken{
+			Key:       hash,
+			UserKey:   "1",
+			Family:    "expired",
+			ExpiresAt: time.Now().Add(-time.Minute).UTC(),
+			CreatedAt: time.Now().Add(-time.Hour).UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := ts.request("POST", "/api/v1/auth/refresh", "", `{"refresh_token":"`+token+`"}`)
+		expectError(t, w, http.StatusUnauthorized, "unauthorized")
+		_, err = ts.RefreshTokens.Get(context.Background(), hash)
+		if err != repositories.ErrNotFound {
+			t.Errorf("the expired token is kept: %v", err)
+		}
+	})
+
+	t.Run("rejects the token of a trashed user", func(t *testing.T) {
+		key := ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+		tokens := ts.login("bob@example.com", testPassword)
+		ts.trash("users", key)
+		if ts.refresh(tokens.RefreshToken) != nil {
+			t.Errorf("the token of the trashed user works")
+		}
+	})
+
+	t.Run("rejects an unknown token", func(t *testing.T) {
+		w := ts.request("POST", "/api/v1/auth/refresh", "", `{"refresh_token":"unknown"}`)
+		expectError(t, w, http.StatusUnauthorized, "unauthorized")
+		w = ts.request("POST", "/api/v1/auth/refresh", "", `{}`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+	})
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+
+	first := ts.login("alice@example.com", testPassword)
+	second := ts.refresh(first.RefreshToken)
+	if second == nil {
+		t.Fatalf("the token is rejected")
+	}
+	w := ts.request("POST", "/api/v1/auth/logout", "", `{"refresh_token":"`+second.RefreshToken+`"}`)
+	expectStatus(t, w, http.StatusNoContent)
+	if ts.refresh(second.RefreshToken) != nil {
+		t.Errorf("the token works after logout")
+	}
+
+	// logging out twice is not an error
+	w = ts.request("POST", "/api/v1/auth/logout", "", `{"refresh_token":"`+second.RefreshToken+`"}`)
+	expectStatus(t, w, http.StatusNoContent)
+	w = ts.request("POST", "/api/v1/auth/logout", "", `{}`)
+	expectError(t, w, http.StatusBadRequest, "validation_failed")
+}
+
+func TestAuthenticate(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+
+	w := ts.request("GET", "/api/v1/users/"+key, "", "")
+	expectError(t, w, http.StatusUnauthorized, "unauthorized")
+	w = ts.request("GET", "/api/v1/users/"+key, "not a token", "")
+	expectError(t, w, http.StatusUnauthorized, "invalid_token")
+	w = ts.request("GET", "/api/v1/users/"+key, ts.token(key), "")
+	expectStatus(t, w, http.StatusOK)
+
+	// the token outlives the user
+	trashed := ts.insertUser("Trashed", "trashed@example.com", models.RoleMember)
+	token := ts.token(trashed)
+	ts.trash("users", trashed)
+	w = ts.request("GET", "/api/v1/users/"+key, token, "")
+	expectError(t, w, http.StatusUnauthorized, "invalid_token")
+	w = ts.request("GET", "/api/v1/users/"+key, ts.token("missing"), "")
+	expectError(t, w, http.StatusUnauthorized, "invalid_token")
+}
@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"groupware-gin/blobs"
+	"groupware-gin/helpers"
+	"groupware-gin/images"
+	"groupware-gin/models"
+	"groupware-gin/repositories"
+)
+
+var (
+	errNoAvatar       = errors.New("this user has no avatar")
+	errAvatarTooLarge = errors.New("the avatar is too large")
+)
+
+// decoding more pixels may exhaust the memory
+const avatarMaxPixels = 25 * 1000 * 1000
+
+// AvatarMaxSize reads AVATAR_MAX_SIZE in bytes, that is 5 MiB unless set
+func AvatarMaxSize() (int64, error) {
+	size, err := helpers.EnvInt("AVATAR_MAX_SIZE", 5<<20)
+	if err != nil {
+		return 0, err
+	}
+	if size <= 0 {
+		return 0, errors.New("AVATAR_MAX_SIZE must be positive")
+	}
+	return int64(size), nil
+}
+
+// ThumbnailSizes reads AVATAR_THUMBNAIL_SIZES like 64,128,256
+func ThumbnailSizes() ([]int, error) {
+	value := os.Getenv("AVATAR_THUMBNAIL_SIZES")
+	if value == "" {
+		value = "64,128,256"
+	}
+	sizes := []int{}
+	for _, item := range strings.Split(value, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || size <= 0 || size > 1024 {
+			return nil, fmt.Errorf("unsupported AVATAR_THUMBNAIL_SIZES %q", value)
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+type storedAvatar struct {
+	Key        string
+	Thumbnails map[string]string
+}
+
+// readAvatar checks the uploaded image, and makes the cleaned one with its thumbnails,
+// or returns nil if it is not uploaded
+func readAvatar(c *gin.Context) (*images.Result, error) {
+	maxSize, err := AvatarMaxSize()
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := ThumbnailSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	// read the file
+	file, err := c.FormFile("avatar")
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return nil, nil // the avatar is optional
+	} else if err != nil {
+		return nil, err
+	}
+	if file.Size > maxSize {
+		return nil, errAvatarTooLarge
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, errAvatarTooLarge
+	}
+
+	// clean the image and make the thumbnails
+	result, err := images.Process(data, sizes, avatarMaxPixels)
+	if err == images.ErrUnsupportedFormat {
+		return nil, fieldInvalid("avatar", "image")
+	} else if err == images.ErrTooManyPixels {
+		return nil, fieldInvalid("avatar", "pixels", strconv.Itoa(avatarMaxPixels/1000/1000))
+	}
+	return result, err
+}
+
+// storeAvatar stores the files next to each other under the prefix like users/<key>,
+// like <uuid>.jpg and <uuid>_64.jpg
+func (s *Server) storeAvatar(ctx context.Context, prefix string, result *images.Result) (*storedAvatar, error) {
+	base := prefix + "/" + uuid.New().String()
+	avatar := &storedAvatar{
+		Key:        base + result.Original.Ext,
+		Thumbnails: map[string]string{},
+	}
+	err := s.putEncoded(ctx, avatar.Key, result.Original)
+	if err != nil {
+		return nil, err
+	}
+	for size, thumbnail := range result.Thumbnails {
+		key := base + "_" + strconv.Itoa(size) + thumbnail.Ext
+		avatar.Thumbnails[strconv.Itoa(size)] = key
+		err = s.putEncoded(ctx, key, thumbnail)
+		if err != nil {
+			s.deleteAvatar(ctx, avatar.Key, avatar.Thumbnails)
+			return nil, err
+		}
+	}
+	return avatar, nil
+}
+
+func (s *Server) putEncoded(ctx context.Context, key string, file images.Encoded) error {
+	return s.Storage.Put(ctx, key, bytes.NewReader(file.Data), int64(len(file.Data)), file.ContentType)
+}
+
+// deleteAvatar removes the avatar with its thumbnails, ignoring the errors,
+// because the files left behind are removed with the user at last
+func (s *Server) deleteAvatar(ctx context.Context, key string, thumbnails map[string]string) {
+	if key != "" {
+		s.Storage.Delete(ctx, key)
+	}
+	for _, thumbnail := range thumbnails {
+		s.Storage.Delete(ctx, thumbnail)
+	}
+}
+
+func avatarStatus(err error) int {
+	var validationError *ValidationError
+	switch {
+	case err == errAvatarTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &validationError):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// limitBody rejects the body larger than the avatar with the other fields
+func limitBody(c *gin.Context) error {
+	maxSize, err := AvatarMaxSize()
+	if err != nil {
+		return err
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+	return nil
+}
+
+/*
+ * GET /users/:key/avatar
+ *
+ * Show the avatar of a user, or its thumbnail by ?size=64
+ */
+
+func (s *Server) ShowAvatar(c *gin.Context) {
+	ctx := context.Background()
+
+	// find the file
+	doc, err := s.Users.Get(ctx, c.Param("key"))
+	if err == repositories.ErrNotFound {
+		abortWithError(c, http.StatusNotFound, errors.New("this user does not exist"))
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if doc.DeletedAt != nil {
+		abortWithError(c, http.StatusGone, errors.New("this user is trashed"))
+		return
+	}
+	key := doc.Avatar
+	if size := c.Query("size"); size != "" {
+		key = doc.Thumbnails[size]
+	}
+	if key == "" {
+		abortWithError(c, http.StatusNotFound, errNoAvatar)
+		return
+	}
+	file, info, err := s.Storage.Get(ctx, key)
+	if err == blobs.ErrNotFound {
+		abortWithError(c, http.StatusNotFound, errNoAvatar)
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	defer file.Close()
+
+	// the file of a key never changes, because a new avatar has a new key
+	// with new thumbnails, so the URL with the version of the avatar is
+	// cached for good, and the one without it is revalidated by the ETag
+	contentType := info.ContentType
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = "application/octet-stream" // never render the uploaded file as a page
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("ETag", avatarETag(key))
+	if c.Query("v") == avatarVersion(doc.Avatar) {
+		c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "private, no-cache")
+	}
+
+	// ServeContent answers Range, If-Range, If-None-Match and If-Modified-Since
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, file)
+}
+
+func avatarETag(key string) string {
+	return `"` + avatarVersion(key) + `"`
+}
+
+// avatarVersion changes with the avatar, so it busts the caches of the URL
+func avatarVersion(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+/*
+ * GET /users/:key/avatar/url
+ *
+ * Sign the URL of the avatar for the tags like <img>, the URL changes
+ * with the avatar so the browsers may cache it for good
+ */
+
+func (s *Server) SignAvatarURL(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate params
+	doc, err := s.Users.Get(ctx, c.Param("key"))
+	if err != nil {
+		abortWithError(c, paramsStatus(err), err)
+		return
+	}
+
+	// sign the path of ShowAvatar, with the version that lets it be cached
+	url, expiresAt := s.URLs.Sign(strings.TrimSuffix(c.Request.URL.Path, "/url"))
+	if doc.Avatar != "" {
+		url += "&v=" + avatarVersion(doc.Avatar)
+	}
+	c.JSON(http.StatusOK, models.SignedURL{
+		URL:       url,
+		ExpiresAt: expiresAt,
+	})
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"testing"
+
+	"groupware-gin/models"
+)
+
+// testImage encodes a PNG of the size
+func testImage(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestShowAvatar(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	token := ts.token(key)
+	other := ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+
+	w := ts.upload("PATCH", "/api/v1/users/"+key, token, nil, testImage(t, 300, 200))
+	expectStatus(t, w, http.StatusOK)
+
+	w = ts.request("GET", "/api/v1/users/"+key+"/avatar", token, "")
+	expectStatus(t, w, http.StatusOK)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "image/") || w.Body.Len() == 0 {
+		t.Fatalf("got %q of %d bytes", w.Header().Get("Content-Type"), w.Body.Len())
+	}
+	original, _, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	if err != nil || original.Width != 300 {
+		t.Errorf("got %+v, %v", original, err)
+	}
+	if w.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Errorf("got Cache-Control %q without the version", w.Header().Get("Cache-Control"))
+	}
+	etag := w.Header().Get("ETag")
+	w = ts.request("GET", "/api/v1/users/"+key+"/avatar", token, "", "If-None-Match", etag)
+	expectStatus(t, w, http.StatusNotModified)
+
+	w = ts.request("GET", "/api/v1/users/"+key+"/avatar?size=64", token, "")
+	expectStatus(t, w, http.StatusOK)
+	thumbnail, _, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	if err != nil || thumbnail.Width != 64 || thumbnail.Height != 64 {
+		t.Errorf("got %+v, %v", thumbnail, err)
+	}
+
+	w = ts.request("GET", "/api/v1/users/"+key+"/avatar?size=65", token, "")
+	expectError(t, w, http.StatusNotFound, "no_avatar")
+	w = ts.request("GET", "/api/v1/users/"+other+"/avatar", token, "")
+	expectError(t, w, http.StatusNotFound, "no_avatar")
+	w = ts.request("GET", "/api/v1/users/missing/avatar", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+	w = ts.request("GET", "/api/v1/users/"+key+"/avatar", "", "")
+	expectError(t, w, http.StatusUnauthorized, "unauthorized")
+}
+
+func TestSignAvatarURL(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	token := ts.token(key)
+	w := ts.upload("PATCH", "/api/v1/users/"+key, token, nil, testImage(t, 100, 100))
+	expectStatus(t, w, http.StatusOK)
+
+	w = ts.request("GET", "/api/v1/users/"+key+"/avatar/url", token, "")
+	expectStatus(t, w, http.StatusOK)
+	var signed models.SignedURL
+	decodeBody(t, w, &signed)
+	if !strings.HasPrefix(signed.URL, "/api/v1/users/"+key+"/avatar?") || signed.ExpiresAt.IsZero() {
+		t.Fatalf("got %+v", signed)
+	}
+
+	// the signed URL works without the access token, and is cached by the version
+	w = ts.request("GET", signed.URL, "", "")
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("Cache-Control") != "private, max-age=31536000, immutable" {
+		t.Errorf("got Cache-Control %q", w.Header().Get("Cache-Control"))
+	}
+	w = ts.request("GET", signed.URL+"&size=64", "", "")
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("Cache-Control") != "private, max-age=31536000, immutable" {
+		t.Errorf("got Cache-Control %q for the thumbnail", w.Header().Get("Cache-Control"))
+	}
+
+	// a new avatar has a new version
+	w = ts.upload("PATCH", "/api/v1/users/"+key, token, nil, testImage(t, 120, 120))
+	expectStatus(t, w, http.StatusOK)
+	w = ts.request("GET", signed.URL, "", "")
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("Cache-Control") != "private, no-cache" {
+		t.Errorf("got Cache-Control %q by the old version", w.Header().Get("Cache-Control"))
+	}
+	w = ts.request("GET", strings.Replace(signed.URL, "signature=", "signature=x", 1), "", "")
+	expectError(t, w, http.StatusForbidden, "invalid_signature")
+	w = ts.request("GET", "/api/v1/users/missing/avatar/url", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
+
+func TestUploadAvatar(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	token := ts.token(key)
+
+	w := ts.upload("PATCH", "/api/v1/users/"+key, token, nil, []byte("<html>not an image</html>"))
+	expectError(t, w, http.StatusBadRequest, "validation_failed")
+
+	t.Setenv("AVATAR_MAX_SIZE", "100")
+	w = ts.upload("PATCH", "/api/v1/users/"+key, token, nil, testImage(t, 200, 200))
+	expectError(t, w, http.StatusRequestEntityTooLarge, "avatar_too_large")
+}
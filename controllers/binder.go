@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errUnsupportedMediaType = errors.New("the body must be application/json or multipart/form-data")
+
+// bindBody decodes the body into the params by its content type,
+// so the same fields can be sent as JSON or as form.
+// the form may have the uploaded files of the given fields,
+// and any other field is rejected in both modes.
+// an empty body decodes nothing, and the validation reports the required fields.
+func bindBody(c *gin.Context, params interface{}, files ...string) error {
+	switch c.ContentType() {
+	case "", gin.MIMEJSON:
+		return decodeStrictJSON(c.Request.Body, params)
+	case gin.MIMEMultipartPOSTForm:
+		form, err := c.MultipartForm()
+		if err != nil {
+			return err
+		}
+		for field := range form.File {
+			if !isAllowedField(field, files) {
+				return fieldInvalid(field, "unknown")
+			}
+		}
+		return bindForm(form.Value, params)
+	case gin.MIMEPOSTForm:
+		err := c.Request.ParseForm()
+		if err != nil {
+			return err
+		}
+		return bindForm(c.Request.PostForm, params)
+	default:
+		return errUnsupportedMediaType
+	}
+}
+
+func bindStatus(err error) int {
+	switch {
+	case err == errUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case strings.Contains(err.Error(), "http: request body too large"): // by http.MaxBytesReader
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// bindForm decodes the text fields through JSON,
+// so they are checked by the same rules as the JSON body
+func bindForm(values url.Values, params interface{}) error {
+	fields := map[string]string{}
+	for field, items := range values {
+		if len(items) != 1 {
+			return fieldInvalid(field, "single")
+		}
+		fields[field] = items[0]
+	}
+	buf, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return decodeStrictJSON(bytes.NewReader(buf), params)
+}
+
+// decodeStrictJSON reports an unknown field as a validation failure of the field
+func decodeStrictJSON(body io.Reader, params interface{}) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(params)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field, unquoteErr := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		if unquoteErr == nil {
+			return fieldInvalid(field, "unknown")
+		}
+	}
+	return err
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"fmt"
+	"os"
+
+	"groupware-gin/repositories"
+)
+
+// DefaultCascade reads ERASE_CASCADE, that is block unless set
+func DefaultCascade() (string, error) {
+	cascade := os.Getenv("ERASE_CASCADE")
+	switch cascade {
+	case "":
+		return repositories.CascadeBlock, nil
+	case repositories.CascadeBlock, repositories.CascadeDelete, repositories.CascadeTrash:
+		return cascade, nil
+	default:
+		return "", fmt.Errorf("unsupported ERASE_CASCADE %q", cascade)
+	}
+}
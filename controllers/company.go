@@ -2,31 +2,40 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
 	"strings"
 	"time"
 
-	driver "github.com/arangodb/go-driver"
 	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
 	"github.com/joncalhoun/qson"
 
 	"groupware-gin/models"
+	"groupware-gin/repositories"
 )
 
+var errCompanyNameUsed = errors.New("this company name is already used")
+
 /*
  * GET /companies
  *
  * Find some companies
  */
 
+var companySortFields = []string{"name", "since", "created_at", "updated_at", "_key"}
+
 type FindCompaniesParams struct {
-	Search string `json:"search" valid:"optional"`
-	SortBy string `json:"sort_by" valid:"optional,in(name|since)"`
-	Limit  *int   `json:"limit" valid:"optional,range(5|100)"`
+	Search      string `json:"search" valid:"optional"`
+	Sort        string `json:"sort" valid:"optional"`                   // like -since,name
+	SortBy      string `json:"sort_by" valid:"optional,in(name|since)"` // deprecated, use sort
+	Limit       *int   `json:"limit" valid:"optional,range(5|100)"`
+	Offset      *int   `json:"offset" valid:"optional,range(0|1000000)"`
+	Cursor      string `json:"cursor" valid:"optional"`
+	WithTrashed bool   `json:"with_trashed" valid:"optional"`
+	OnlyTrashed bool   `json:"only_trashed" valid:"optional"`
+
+	Filter map[string]interface{} `json:"filter" valid:"-"` // like filter[name][contains]=foo
 }
 
 func (s *Server) FindCompanies(c *gin.Context) {
@@ -37,58 +46,54 @@ func (s *Server) FindCompanies(c *gin.Context) {
 	if c.Request.URL.RawQuery != "" { // hack: qson fails on empty string
 		err := qson.Unmarshal(&params, c.Request.URL.RawQuery)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, err)
+			abortWithError(c, http.StatusBadRequest, err)
 			return
 		}
 		params.Search = strings.TrimSpace(params.Search)
-		result, err := govalidator.ValidateStruct(params)
+		err = validate(params)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, err)
+			abortWithError(c, http.StatusBadRequest, err)
 			return
 		}
-		if !result {
-			c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+		if params.WithTrashed && params.OnlyTrashed {
+			abortWithError(c, http.StatusBadRequest, errors.New("with_trashed and only_trashed cannot be used together"))
 			return
 		}
 	}
-
-	// perform DB query
-	query := make([]string, 0)
-	query = append(query, "FOR x IN companies")
-	bindVars := gin.H{}
-	if params.Search != "" {
-		query = append(query, "FILTER CONTAINS(x.name, @search)")
-		bindVars["search"] = params.Search
+	offset, limit, err := pageWindow(params.Cursor, params.Offset, params.Limit)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
 	}
-	if params.SortBy != "" {
-		query = append(query, "SORT x."+params.SortBy+" ASC")
+	if params.Sort == "" {
+		params.Sort = params.SortBy
 	}
-	if params.Limit != nil {
-		query = append(query, "LIMIT 0, @limit")
-		bindVars["limit"] = params.Limit
+	sort, err := parseSort(params.Sort, companySortFields)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
 	}
-	query = append(query, "RETURN x")
-	cursor, err := s.DB.Query(ctx, strings.Join(query, " "), bindVars)
+	filter, err := parseFilter(params.Filter, companyFilterFields)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
-	defer cursor.Close()
 
 	// make a result
-	companies := []models.Company{}
-	var doc models.Company
-	for {
-		_, err := cursor.ReadDocument(ctx, &doc)
-		if driver.IsNoMoreDocuments(err) {
-			break
-		} else if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
-			return
-		}
-		companies = append(companies, doc)
+	companies, total, err := s.Companies.List(ctx, repositories.ListOptions{
+		Search:      params.Search,
+		Filter:      filter,
+		Sort:        sort,
+		Offset:      offset,
+		Limit:       limit,
+		WithTrashed: params.WithTrashed,
+		OnlyTrashed: params.OnlyTrashed,
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
 	}
-	c.JSON(http.StatusOK, companies)
+	jsonWithETag(c, newPage(c, companies, total, offset, limit))
 }
 
 /*
@@ -97,31 +102,38 @@ func (s *Server) FindCompanies(c *gin.Context) {
  * Show a company
  */
 
+type ShowCompanyParams struct {
+	WithTrashed bool `json:"with_trashed" valid:"optional"`
+}
+
 func (s *Server) ShowCompany(c *gin.Context) {
 	ctx := context.Background()
-	companies, err := s.DB.Collection(ctx, "companies")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
-		return
+
+	// validate URL query
+	var params ShowCompanyParams
+	if c.Request.URL.RawQuery != "" { // hack: qson fails on empty string
+		err := qson.Unmarshal(&params, c.Request.URL.RawQuery)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
 	}
 
-	// validate params
-	key := c.Param("key")
-	found, err := companies.DocumentExists(ctx, key)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	// make a result
+	doc, err := s.Companies.Get(ctx, c.Param("key"))
+	if err == repositories.ErrNotFound {
+		abortWithError(c, http.StatusNotFound, errors.New("this company does not exist"))
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
-	if !found {
-		c.JSON(http.StatusNotFound, errors.New("this company does not exist"))
+	if doc.DeletedAt != nil && !params.WithTrashed {
+		abortWithError(c, http.StatusGone, errors.New("this company is trashed"))
 		return
 	}
-
-	// make a result
-	var doc models.Company
-	_, err = companies.ReadDocument(ctx, key, &doc)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	if notModified(c, doc.Rev, doc.UpdatedAt) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 	c.JSON(http.StatusOK, doc)
@@ -134,52 +146,42 @@ func (s *Server) ShowCompany(c *gin.Context) {
  */
 
 type StoreCompanyParams struct {
-	Name      string    `json:"name" valid:"required,notnull"`
-	Since     string    `json:"since" valid:"required,rfc3339"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Name  string `json:"name" valid:"required,notnull"`
+	Since string `json:"since" valid:"required,rfc3339"`
 }
 
 func (s *Server) StoreCompany(c *gin.Context) {
 	ctx := context.Background()
 
 	// validate payload
-	dec := json.NewDecoder(c.Request.Body)
-	dec.DisallowUnknownFields()
 	var params StoreCompanyParams
-	err := dec.Decode(&params)
+	err := bindBody(c, &params)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, bindStatus(err), err)
 		return
 	}
 	params.Name = govalidator.Trim(params.Name, "")
-	now := time.Now().UTC()
-	params.CreatedAt = now
-	params.UpdatedAt = now
-	res, err := govalidator.ValidateStruct(params)
+	err = validate(params)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
-		return
-	}
-	if !res {
-		c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
+	since, _ := time.Parse(time.RFC3339, params.Since) // validated already
+
 	// create a document
-	companies, err := s.DB.Collection(ctx, "companies")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	doc, err := s.Companies.Create(ctx, models.Company{
+		Name:  params.Name,
+		Since: since.UTC(),
+	})
+	if err == repositories.ErrConflict {
+		abortWithError(c, http.StatusConflict, errCompanyNameUsed)
 		return
-	}
-	var doc models.Company
-	otherCtx := driver.WithReturnNew(ctx, &doc)
-	anotherCtx := driver.WithKeepNull(otherCtx, false)
-	_, err = companies.CreateDocument(anotherCtx, params)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
+	setETag(c, doc.Rev)
 	c.JSON(http.StatusOK, doc)
 }
 
@@ -192,24 +194,13 @@ func (s *Server) StoreCompany(c *gin.Context) {
 func (s *Server) validateCompanyParams(c *gin.Context) (string, error) {
 	ctx := context.Background()
 	key := c.Param("key")
-	companies, err := s.DB.Collection(ctx, "companies")
-	if err != nil {
-		return "", err
-	}
-	found, err := companies.DocumentExists(ctx, key)
-	if err != nil {
-		return key, err
-	}
-	if !found {
-		return key, errors.New("does not exist")
-	}
-	return key, nil
+	_, err := s.Companies.Get(ctx, key)
+	return key, err // ErrNotFound for a missing company
 }
 
 type UpdateCompanyParams struct {
-	Name      string    `json:"name,omitempty" validate:"optional,notnull"`
-	Since     string    `json:"since,omitempty" validate:"optional,rfc3339"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Name  string `json:"name,omitempty" valid:"optional"`
+	Since string `json:"since,omitempty" valid:"optional,rfc3339"`
 }
 
 func (s *Server) UpdateCompany(c *gin.Context) {
@@ -218,46 +209,66 @@ func (s *Server) UpdateCompany(c *gin.Context) {
 	// validate params
 	key, err := s.validateCompanyParams(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, paramsStatus(err), err)
+		return
+	}
+
+	// check permission
+	allowed, err := s.canManageCompany(c, key)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		abortWithError(c, http.StatusForbidden, errPermissionDenied)
+		return
+	}
+
+	// the revision that the client has edited
+	rev, err := s.ifMatch(c)
+	if err != nil {
+		abortWithError(c, preconditionStatus(err), err)
 		return
 	}
 
 	// validate payload
-	dec := json.NewDecoder(c.Request.Body)
-	dec.DisallowUnknownFields()
 	var params UpdateCompanyParams
-	err = dec.Decode(&params)
+	err = bindBody(c, &params)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, bindStatus(err), err)
 		return
 	}
 	if params.Name != "" {
 		params.Name = govalidator.Trim(params.Name, "") // empty string means default token
 	}
-	params.UpdatedAt = time.Now().UTC()
-	result, err := govalidator.ValidateStruct(params)
+	err = validate(params)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
-		return
-	}
-	if !result {
-		c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	// update a document
-	companies, err := s.DB.Collection(ctx, "companies")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
-		return
+	var patch repositories.CompanyPatch
+	if params.Name != "" {
+		patch.Name = &params.Name
 	}
-	var doc models.Company
-	otherCtx := driver.WithReturnNew(ctx, &doc)
-	_, err = companies.UpdateDocument(otherCtx, key, params)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	if params.Since != "" {
+		since, _ := time.Parse(time.RFC3339, params.Since) // validated already
+		since = since.UTC()
+		patch.Since = &since
+	}
+	doc, err := s.Companies.Update(ctx, key, rev, patch)
+	if err == repositories.ErrConflict {
+		abortWithError(c, http.StatusConflict, errCompanyNameUsed)
+		return
+	} else if err == repositories.ErrPreconditionFailed {
+		abortWithError(c, http.StatusPreconditionFailed, err)
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
+	setETag(c, doc.Rev)
 	c.JSON(http.StatusOK, doc)
 }
 
@@ -268,7 +279,8 @@ func (s *Server) UpdateCompany(c *gin.Context) {
  */
 
 type DeleteCompanyParams struct {
-	Mode string `json:"mode" valid:"required,in(erase|trash|restore)"`
+	Mode    string `json:"mode" valid:"required,in(erase|trash|restore)"`
+	Cascade string `json:"cascade" valid:"optional,in(block|delete|trash)"` // only for erase, ERASE_CASCADE by default
 }
 
 func (s *Server) DeleteCompany(c *gin.Context) {
@@ -277,67 +289,103 @@ func (s *Server) DeleteCompany(c *gin.Context) {
 	// validate params
 	key, err := s.validateCompanyParams(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, paramsStatus(err), err)
 		return
 	}
 
 	// validate payload
-	dec := json.NewDecoder(c.Request.Body)
-	dec.DisallowUnknownFields()
 	var params DeleteCompanyParams
-	err = dec.Decode(&params)
-	if err != nil && err != io.EOF {
-		c.JSON(http.StatusBadRequest, err)
+	err = bindBody(c, &params)
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
+		return
+	}
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
-	res, err := govalidator.ValidateStruct(params)
+
+	// check permission, only system admins can erase a company with its employment
+	var allowed bool
+	if params.Mode == "erase" {
+		allowed, err = s.isSystemAdmin(ctx, c.GetString("user_key"))
+	} else {
+		allowed, err = s.canManageCompany(c, key)
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
-	if !res {
-		c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+	if !allowed {
+		abortWithError(c, http.StatusForbidden, errPermissionDenied)
 		return
 	}
 
-	// perform an action
-	companies, err := s.DB.Collection(ctx, "companies")
+	// the revision that the client has edited
+	rev, err := s.ifMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		abortWithError(c, preconditionStatus(err), err)
 		return
 	}
+
+	// perform an action
 	if params.Mode == "erase" {
-		// delete a document permanently
-		_, err = companies.RemoveDocument(ctx, key)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+		// delete a document permanently, with its edges in the same transaction
+		cascade := params.Cascade
+		if cascade == "" {
+			cascade, err = DefaultCascade()
+			if err != nil {
+				abortWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		_, err = s.Companies.Erase(ctx, key, rev, cascade)
+		if err == repositories.ErrHasEmployment {
+			abortWithError(c, http.StatusConflict, err)
+			return
+		} else if err == repositories.ErrPreconditionFailed {
+			abortWithError(c, http.StatusPreconditionFailed, err)
+			return
+		} else if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if cascade == repositories.CascadeTrash {
+			// trashed instead of erased
+			doc, err := s.Companies.Get(ctx, key)
+			if err != nil {
+				abortWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+			setETag(c, doc.Rev)
+			c.JSON(http.StatusOK, doc)
 			return
 		}
 		c.JSON(http.StatusNoContent, "")
 	} else if params.Mode == "trash" {
 		// delete a document temporarily
-		var doc models.Company
-		otherCtx := driver.WithReturnNew(ctx, &doc)
-		_, err = companies.UpdateDocument(otherCtx, key, gin.H{
-			"deleted_at": time.Now().UTC(),
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+		doc, err := s.Companies.Trash(ctx, key, rev)
+		if err == repositories.ErrPreconditionFailed {
+			abortWithError(c, http.StatusPreconditionFailed, err)
+			return
+		} else if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
 			return
 		}
+		setETag(c, doc.Rev)
 		c.JSON(http.StatusOK, doc)
 	} else if params.Mode == "restore" {
 		// restore a document that was deleted temprarily
-		otherCtx := driver.WithKeepNull(ctx, false) // don't keep empty field
-		var doc models.Company
-		anotherCtx := driver.WithReturnNew(otherCtx, &doc)
-		_, err = companies.UpdateDocument(anotherCtx, key, gin.H{
-			"deleted_at": nil,
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+		doc, err := s.Companies.Restore(ctx, key, rev)
+		if err == repositories.ErrPreconditionFailed {
+			abortWithError(c, http.StatusPreconditionFailed, err)
+			return
+		} else if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
 			return
 		}
+		setETag(c, doc.Rev)
 		c.JSON(http.StatusOK, doc)
 	}
 }
@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"groupware-gin/models"
+)
+
+type companyPage struct {
+	Data       []models.Company `json:"data"`
+	Total      int64            `json:"total"`
+	NextCursor string           `json:"next_cursor"`
+}
+
+func companyNames(companies []models.Company) []string {
+	names := []string{}
+	for _, company := range companies {
+		names = append(names, company.Name)
+	}
+	return names
+}
+
+func TestFindCompanies(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token(ts.insertUser("Alice", "alice@example.com", models.RoleMember))
+	for _, name := range []string{"Initech", "Acme", "Globex", "Hooli", "Umbrella", "Wayne"} {
+		ts.insertCompany(name)
+	}
+	ts.trash("companies", ts.insertCompany("Trashed"))
+
+	find := func(query string) companyPage {
+		t.Helper()
+		w := ts.request("GET", "/api/v1/companies"+query, token, "")
+		expectStatus(t, w, http.StatusOK)
+		var page companyPage
+		decodeBody(t, w, &page)
+		return page
+	}
+
+	t.Run("sorts and pages", func(t *testing.T) {
+		page := find("?sort=name&limit=5")
+		if page.Total != 6 || len(page.Data) != 5 || page.Data[0].Name != "Acme" || page.NextCursor == "" {
+			t.Fatalf("got %v of %d", companyNames(page.Data), page.Total)
+		}
+		next := find("?sort=name&limit=5&cursor=" + page.NextCursor)
+		if len(next.Data) != 1 || next.Data[0].Name != "Wayne" {
+			t.Errorf("got %v on the next page", companyNames(next.Data))
+		}
+	})
+
+	t.Run("searches and filters", func(t *testing.T) {
+		page := find("?search=oo")
+		if page.Total != 1 || page.Data[0].Name != "Hooli" {
+			t.Errorf("got %v by search", companyNames(page.Data))
+		}
+		page = find("?filter[name][starts_with]=g")
+		if page.Total != 1 || page.Data[0].Name != "Globex" {
+			t.Errorf("got %v by filter", companyNames(page.Data))
+		}
+	})
+
+	t.Run("finds the trashed ones", func(t *testing.T) {
+		page := find("?only_trashed=true")
+		if page.Total != 1 || page.Data[0].Name != "Trashed" {
+			t.Errorf("got %v", companyNames(page.Data))
+		}
+		page = find("?with_trashed=true")
+		if page.Total != 7 {
+			t.Errorf("got %d companies with trashed", page.Total)
+		}
+	})
+
+	t.Run("answers not modified", func(t *testing.T) {
+		w := ts.request("GET", "/api/v1/companies", token, "")
+		expectStatus(t, w, http.StatusOK)
+		etag := w.Header().Get("ETag")
+		w = ts.request("GET", "/api/v1/companies", token, "", "If-None-Match", etag)
+		expectStatus(t, w, http.StatusNotModified)
+	})
+
+	t.Run("validates query", func(t *testing.T) {
+		for _, query := range []string{"?limit=1000", "?sort=password", "?filter[password][eq]=x", "?with_trashed=true&only_trashed=true", "?cursor=broken"} {
+			w := ts.request("GET", "/api/v1/companies"+query, token, "")
+			expectStatus(t, w, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestShowCompany(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token(ts.insertUser("Alice", "alice@example.com", models.RoleMember))
+	key := ts.insertCompany("Acme")
+	trashed := ts.insertCompany("Trashed")
+	ts.trash("companies", trashed)
+
+	w := ts.request("GET", "/api/v1/companies/"+key, token, "")
+	expectStatus(t, w, http.StatusOK)
+	var company models.Company
+	decodeBody(t, w, &company)
+	if company.Key != key || company.Name != "Acme" {
+		t.Errorf("got %+v", company)
+	}
+	if w.Header().Get("ETag") != `"`+company.Rev+`"` {
+		t.Errorf("got ETag %q for %q", w.Header().Get("ETag"), company.Rev)
+	}
+
+	w = ts.request("GET", "/api/v1/companies/"+key, token, "", "If-None-Match", `"`+company.Rev+`"`)
+	expectStatus(t, w, http.StatusNotModified)
+	w = ts.request("GET", "/api/v1/companies/missing", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+	w = ts.request("GET", "/api/v1/companies/"+trashed, token, "")
+	expectError(t, w, http.StatusGone, "gone")
+	w = ts.request("GET", "/api/v1/companies/"+trashed+"?with_trashed=true", token, "")
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestStoreCompany(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	member := ts.token(ts.insertUser("Alice", "alice@example.com", models.RoleMember))
+
+	w := ts.request("POST", "/api/v1/companies", admin, `{"name":" Acme ","since":"2001-02-03T00:00:00Z"}`)
+	expectStatus(t, w, http.StatusOK)
+	var company models.Company
+	decodeBody(t, w, &company)
+	if company.Key == "" || company.Name != "Acme" || company.Since.Year() != 2001 {
+		t.Errorf("got %+v", company)
+	}
+
+	w = ts.request("POST", "/api/v1/companies", admin, `{"name":"Acme","since":"2001-02-03T00:00:00Z"}`)
+	expectError(t, w, http.StatusConflict, "unique_violation")
+	w = ts.request("POST", "/api/v1/companies", admin, `{"name":"acme","since":"2001-02-03T00:00:00Z"}`)
+	expectError(t, w, http.StatusConflict, "unique_violation")
+	w = ts.request("POST", "/api/v1/companies", admin, `{"name":"Globex","since":"yesterday"}`)
+	expectError(t, w, http.StatusBadRequest, "validation_failed")
+	w = ts.request("POST", "/api/v1/companies", member, `{"name":"Globex","since":"2001-02-03T00:00:00Z"}`)
+	expectError(t, w, http.StatusForbidden, "permission_denied")
+}
+
+func TestUpdateCompany(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	ownerKey := ts.insertUser("Owner", "owner@example.com", models.RoleMember)
+	member := ts.token(ts.insertUser("Alice", "alice@example.com", models.RoleMember))
+	key := ts.insertCompany("Acme")
+	ts.insertCompany("Globex")
+	ts.insertWorkAt(ownerKey, key, models.RoleAdmin, "2020-01-01T00:00:00Z", "")
+
+	w := ts.request("PATCH", "/api/v1/companies/"+key, admin, `{"name":"Acme Corp"}`)
+	expectStatus(t, w, http.StatusOK)
+	var company models.Company
+	decodeBody(t, w, &company)
+	if company.Name != "Acme Corp" {
+		t.Errorf("got %+v", company)
+	}
+
+	t.Run("allows the company admin", func(t *testing.T) {
+		w := ts.request("PATCH", "/api/v1/companies/"+key, ts.token(ownerKey), `{"since":"1999-01-01T00:00:00Z"}`)
+		expectStatus(t, w, http.StatusOK)
+		w = ts.request("PATCH", "/api/v1/companies/"+key, member, `{"name":"Mine"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+	})
+
+	t.Run("checks If-Match", func(t *testing.T) {
+		w := ts.request("PATCH", "/api/v1/companies/"+key, admin, `{"name":"Acme"}`, "If-Match", `"`+company.Rev+`"`)
+		expectError(t, w, http.StatusPreconditionFailed, "precondition_failed")
+		w = ts.request("GET", "/api/v1/companies/"+key, admin, "")
+		w = ts.request("PATCH", "/api/v1/companies/"+key, admin, `{"name":"Acme"}`, "If-Match", w.Header().Get("ETag"))
+		expectStatus(t, w, http.StatusOK)
+	})
+
+	t.Run("rejects the wrong changes", func(t *testing.T) {
+		w := ts.request("PATCH", "/api/v1/companies/"+key, admin, `{"name":"globex"}`)
+		expectError(t, w, http.StatusConflict, "unique_violation")
+		w = ts.request("PATCH", "/api/v1/companies/"+key, admin, `{"owner":"me"}`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+		w = ts.request("PATCH", "/api/v1/companies/missing", admin, `{"name":"Nothing"}`)
+		expectError(t, w, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestDeleteCompany(t *testing.T) {
+	ts := newTestServer(t)
+	adminKey := ts.insertUser("Admin", "admin@example.com", models.RoleAdmin)
+	admin := ts.token(adminKey)
+	userKey := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	member := ts.token(userKey)
+
+	t.Run("trashes and restores", func(t *testing.T) {
+		key := ts.insertCompany("Acme")
+		w := ts.request("DELETE", "/api/v1/companies/"+key, admin, `{"mode":"trash"}`)
+		expectStatus(t, w, http.StatusOK)
+		var company models.Company
+		decodeBody(t, w, &company)
+		if company.DeletedAt == nil {
+			t.Errorf("got %+v", company)
+		}
+		w = ts.request("DELETE", "/api/v1/companies/"+key, admin, `{"mode":"restore"}`)
+		expectStatus(t, w, http.StatusOK)
+		company = models.Company{}
+		decodeBody(t, w, &company)
+		if company.DeletedAt != nil {
+			t.Errorf("got %+v", company)
+		}
+	})
+
+	t.Run("erases by the cascade", func(t *testing.T) {
+		key := ts.insertCompany("Globex")
+		edge := ts.insertWorkAt(userKey, key, models.RoleMember, "2020-01-01T00:00:00Z", "")
+		w := ts.request("DELETE", "/api/v1/companies/"+key, admin, `{"mode":"erase"}`)
+		expectError(t, w, http.StatusConflict, "has_employment")
+
+		w = ts.request("DELETE", "/api/v1/companies/"+key, admin, `{"mode":"erase","cascade":"trash"}`)
+		expectStatus(t, w, http.StatusOK)
+		doc, _ := ts.store.Document("work_at", edge)
+		if doc["until"] == nil {
+			t.Errorf("the employment is not ended: %v", doc)
+		}
+
+		w = ts.request("DELETE", "/api/v1/companies/"+key, admin, `{"mode":"erase","cascade":"delete"}`)
+		expectStatus(t, w, http.StatusNoContent)
+		if _, err := ts.store.Document("companies", key); err == nil {
+			t.Errorf("the company is kept")
+		}
+		if _, err := ts.store.Document("work_at", edge); err == nil {
+			t.Errorf("the employment is kept")
+		}
+	})
+
+	t.Run("limits erase to system admins", func(t *testing.T) {
+		key := ts.insertCompany("Initech")
+		ownerKey := ts.insertUser("Owner", "owner@example.com", models.RoleMember)
+		owner := ts.token(ownerKey)
+		edge := ts.insertWorkAt(ownerKey, key, models.RoleAdmin, "2020-01-01T00:00:00Z", "")
+		w := ts.request("DELETE", "/api/v1/companies/"+key, owner, `{"mode":"erase","cascade":"delete"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+		if _, err := ts.store.Document("work_at", edge); err != nil {
+			t.Errorf("the employment is erased: %v", err)
+		}
+
+		// the company admin can still trash it
+		w = ts.request("DELETE", "/api/v1/companies/"+key, owner, `{"mode":"trash"}`)
+		expectStatus(t, w, http.StatusOK)
+	})
+
+	t.Run("rejects the wrong requests", func(t *testing.T) {
+		key := ts.insertCompany("Hooli")
+		// the payload is checked before the permission and the revision
+		w := ts.request("DELETE", "/api/v1/companies/"+key, member, `{"mode":"burn"}`, "If-Match", `"stale"`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+		w = ts.request("DELETE", "/api/v1/companies/"+key, member, `{"mode":"trash"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+		w = ts.request("DELETE", "/api/v1/companies/missing", admin, `{"mode":"trash"}`)
+		expectError(t, w, http.StatusNotFound, "not_found")
+		w = ts.request("DELETE", "/api/v1/companies/"+key, admin, `{"mode":"trash"}`, "If-Match", `"stale"`)
+		expectError(t, w, http.StatusPreconditionFailed, "precondition_failed")
+	})
+}
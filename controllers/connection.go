@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joncalhoun/qson"
+)
+
+/*
+ * GET /users/:key/colleagues
+ *
+ * Find the users who work at the same company now
+ */
+
+func (s *Server) FindColleagues(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate params
+	key, err := s.validateUserParams(c)
+	if err != nil {
+		abortWithError(c, paramsStatus(err), err)
+		return
+	}
+
+	// make a result
+	colleagues, err := s.Employment.Colleagues(ctx, key)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, colleagues)
+}
+
+/*
+ * GET /users/:key/connections
+ *
+ * Find the users reachable through current employments,
+ * with the shortest path to each of them
+ */
+
+type FindConnectionsParams struct {
+	Depth *int `json:"depth" valid:"optional,range(1|3)"`
+}
+
+func (s *Server) FindConnections(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate params
+	key, err := s.validateUserParams(c)
+	if err != nil {
+		abortWithError(c, paramsStatus(err), err)
+		return
+	}
+
+	// validate URL query
+	var params FindConnectionsParams
+	if c.Request.URL.RawQuery != "" { // hack: qson fails on empty string
+		err := qson.Unmarshal(&params, c.Request.URL.RawQuery)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		err = validate(params)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	depth := 2 // friends of friends
+	if params.Depth != nil {
+		depth = *params.Depth
+	}
+
+	// make a result
+	connections, err := s.Employment.Connections(ctx, key, depth)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, connections)
+}
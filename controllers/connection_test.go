@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"groupware-gin/models"
+)
+
+// alice and bob work at acme, bob and carol at globex,
+// and dave worked at acme only in the past
+func connectionFixture(t *testing.T) (*testServer, map[string]string) {
+	ts := newTestServer(t)
+	keys := map[string]string{
+		"alice": ts.insertUser("Alice", "alice@example.com", models.RoleMember),
+		"bob":   ts.insertUser("Bob", "bob@example.com", models.RoleMember),
+		"carol": ts.insertUser("Carol", "carol@example.com", models.RoleMember),
+		"dave":  ts.insertUser("Dave", "dave@example.com", models.RoleMember),
+		"acme":  ts.insertCompany("Acme"),
+		"globe": ts.insertCompany("Globex"),
+	}
+	ts.insertWorkAt(keys["alice"], keys["acme"], models.RoleMember, "2020-01-01T00:00:00Z", "")
+	ts.insertWorkAt(keys["bob"], keys["acme"], models.RoleMember, "2020-01-01T00:00:00Z", "")
+	ts.insertWorkAt(keys["bob"], keys["globe"], models.RoleMember, "2020-01-01T00:00:00Z", "")
+	ts.insertWorkAt(keys["carol"], keys["globe"], models.RoleMember, "2020-01-01T00:00:00Z", "")
+	ts.insertWorkAt(keys["dave"], keys["acme"], models.RoleMember, "2010-01-01T00:00:00Z", "2015-01-01T00:00:00Z")
+	return ts, keys
+}
+
+func TestFindColleagues(t *testing.T) {
+	ts, keys := connectionFixture(t)
+	token := ts.token(keys["alice"])
+
+	w := ts.request("GET", "/api/v1/users/"+keys["bob"]+"/colleagues", token, "")
+	expectStatus(t, w, http.StatusOK)
+	var colleagues []models.Colleague
+	decodeBody(t, w, &colleagues)
+	got := []string{}
+	for _, colleague := range colleagues {
+		got = append(got, colleague.User.Name+"@"+colleague.Company.Name)
+	}
+	if !equalStrings(got, []string{"Alice@Acme", "Carol@Globex"}) {
+		t.Errorf("got %v", got)
+	}
+
+	w = ts.request("GET", "/api/v1/users/missing/colleagues", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
+
+func TestFindConnections(t *testing.T) {
+	ts, keys := connectionFixture(t)
+	token := ts.token(keys["alice"])
+
+	find := func(query string) []models.Connection {
+		t.Helper()
+		w := ts.request("GET", "/api/v1/users/"+keys["alice"]+"/connections"+query, token, "")
+		expectStatus(t, w, http.StatusOK)
+		var connections []models.Connection
+		decodeBody(t, w, &connections)
+		return connections
+	}
+
+	connections := find("")
+	if len(connections) != 2 || connections[0].User.Name != "Bob" || connections[1].User.Name != "Carol" {
+		t.Fatalf("got %+v", connections)
+	}
+	carol := connections[1]
+	if carol.Degree != 2 || len(carol.Path) != 2 || carol.Path[0].Company.Name != "Acme" || carol.Path[1].From.Name != "Bob" || carol.Path[1].To.Name != "Carol" {
+		t.Errorf("got the path %+v", carol)
+	}
+
+	connections = find("?depth=1")
+	if len(connections) != 1 || connections[0].User.Name != "Bob" {
+		t.Errorf("got %+v by depth 1", connections)
+	}
+
+	w := ts.request("GET", "/api/v1/users/"+keys["alice"]+"/connections?depth=4", token, "")
+	expectError(t, w, http.StatusBadRequest, "validation_failed")
+	w = ts.request("GET", "/api/v1/users/missing/connections", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
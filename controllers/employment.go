@@ -0,0 +1,561 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/joncalhoun/qson"
+
+	"groupware-gin/models"
+	"groupware-gin/repositories"
+)
+
+var (
+	errVertexNotFound = errors.New("does not exist")
+	errVertexTrashed  = errors.New("is trashed")
+	errNotEmployed    = errors.New("this user does not work at this company")
+	errInvalidPeriod  = errors.New("until must be after since")
+)
+
+/*
+ * GET /companies/:key/employees
+ *
+ * Find the users who work at a company
+ */
+
+type FindWorkAtParams struct {
+	Status string `json:"status" valid:"optional,in(current|past|all)"`
+}
+
+func (s *Server) FindEmployees(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate params
+	key, err := s.validateCompanyParams(c)
+	if err != nil {
+		abortWithError(c, paramsStatus(err), err)
+		return
+	}
+
+	// validate URL query
+	params, err := parseFindWorkAtParams(c)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// make a result
+	employees, err := s.Employment.Employees(ctx, key, params.Status)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, employees)
+}
+
+/*
+ * GET /users/:key/employers
+ *
+ * Find the companies where a user works
+ */
+
+func (s *Server) FindEmployers(c *gin.Context) {
+	// validate params
+	key, err := s.validateUserParams(c)
+	if err != nil {
+		abortWithError(c, paramsStatus(err), err)
+		return
+	}
+
+	// validate URL query
+	params, err := parseFindWorkAtParams(c)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	s.findEmployers(c, key, params.Status)
+}
+
+/*
+ * GET /users/:key/career
+ *
+ * Show the timeline of all employments of a user
+ */
+
+func (s *Server) ShowCareer(c *gin.Context) {
+	// validate params
+	key, err := s.validateUserParams(c)
+	if err != nil {
+		abortWithError(c, paramsStatus(err), err)
+		return
+	}
+
+	s.findEmployers(c, key, repositories.WorkAtAll)
+}
+
+func (s *Server) findEmployers(c *gin.Context, userKey string, status string) {
+	ctx := context.Background()
+
+	// make a result, the current employment comes after the past ones
+	employers, err := s.Employment.Employers(ctx, userKey, status)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, employers)
+}
+
+func parseFindWorkAtParams(c *gin.Context) (FindWorkAtParams, error) {
+	var params FindWorkAtParams
+	if c.Request.URL.RawQuery != "" { // hack: qson fails on empty string
+		err := qson.Unmarshal(&params, c.Request.URL.RawQuery)
+		if err != nil {
+			return params, err
+		}
+		err = validate(params)
+		if err != nil {
+			return params, err
+		}
+	}
+	return params, nil
+}
+
+/*
+ * POST /companies/:key/employees
+ * POST /users/:key/employers
+ *
+ * Hire a user at a company
+ */
+
+type StoreEmployeeParams struct {
+	User     string `json:"user" valid:"required"`
+	Since    string `json:"since" valid:"required,rfc3339"`
+	Until    string `json:"until" valid:"optional,rfc3339"`
+	Position string `json:"position" valid:"optional"`
+	Role     string `json:"role" valid:"optional,in(admin|member)"`
+}
+
+type StoreEmployerParams struct {
+	Company  string `json:"company" valid:"required"`
+	Since    string `json:"since" valid:"required,rfc3339"`
+	Until    string `json:"until" valid:"optional,rfc3339"`
+	Position string `json:"position" valid:"optional"`
+	Role     string `json:"role" valid:"optional,in(admin|member)"`
+}
+
+func (s *Server) StoreEmployee(c *gin.Context) {
+	// validate payload
+	var params StoreEmployeeParams
+	err := bindBody(c, &params)
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
+		return
+	}
+	params.Position = govalidator.Trim(params.Position, "")
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	s.storeWorkAt(c, params.User, c.Param("key"), StoreEmployerParams{
+		Company:  c.Param("key"),
+		Since:    params.Since,
+		Until:    params.Until,
+		Position: params.Position,
+		Role:     params.Role,
+	})
+}
+
+func (s *Server) StoreEmployer(c *gin.Context) {
+	// validate payload
+	var params StoreEmployerParams
+	err := bindBody(c, &params)
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
+		return
+	}
+	params.Position = govalidator.Trim(params.Position, "")
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	s.storeWorkAt(c, c.Param("key"), params.Company, params)
+}
+
+func (s *Server) storeWorkAt(c *gin.Context, userKey string, companyKey string, params StoreEmployerParams) {
+	ctx := context.Background()
+
+	// validate both vertices
+	err := s.validateVertex(ctx, "users", userKey)
+	if err != nil {
+		abortWithError(c, vertexErrorStatus(err), fmt.Errorf("user %w", err))
+		return
+	}
+	err = s.validateVertex(ctx, "companies", companyKey)
+	if err != nil {
+		abortWithError(c, vertexErrorStatus(err), fmt.Errorf("company %w", err))
+		return
+	}
+
+	// check permission
+	allowed, err := s.canManageCompany(c, companyKey)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		abortWithError(c, http.StatusForbidden, errPermissionDenied)
+		return
+	}
+
+	// validate the period
+	since, _ := time.Parse(time.RFC3339, params.Since) // already validated
+	since = since.UTC()
+	var until *time.Time
+	if params.Until != "" {
+		t, _ := time.Parse(time.RFC3339, params.Until)
+		t = t.UTC()
+		until = &t
+	}
+	if until != nil && !until.After(since) {
+		abortWithError(c, http.StatusBadRequest, errInvalidPeriod)
+		return
+	}
+
+	// create an edge
+	role := params.Role
+	if role == "" {
+		role = models.RoleMember
+	}
+	doc, err := s.Employment.Create(ctx, models.WorkAt{
+		From:     "users/" + userKey,
+		To:       "companies/" + companyKey,
+		Since:    since,
+		Until:    until,
+		Position: params.Position,
+		Role:     role,
+	})
+	if err == repositories.ErrOverlapped {
+		abortWithError(c, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+/*
+ * PATCH /companies/:key/employees/:user
+ * PATCH /users/:key/employers/:company
+ *
+ * Change the current employment, or move the employee to other company
+ */
+
+type UpdateWorkAtParams struct {
+	Company  string `json:"company,omitempty" valid:"optional"`
+	Since    string `json:"since,omitempty" valid:"optional,rfc3339"`
+	Until    string `json:"until,omitempty" valid:"optional,rfc3339"`
+	Position string `json:"position,omitempty" valid:"optional"`
+	Role     string `json:"role,omitempty" valid:"optional,in(admin|member)"`
+}
+
+func (s *Server) UpdateEmployee(c *gin.Context) {
+	s.updateWorkAt(c, c.Param("user"), c.Param("key"))
+}
+
+func (s *Server) UpdateEmployer(c *gin.Context) {
+	s.updateWorkAt(c, c.Param("key"), c.Param("company"))
+}
+
+func (s *Server) updateWorkAt(c *gin.Context, userKey string, companyKey string) {
+	ctx := context.Background()
+
+	// validate params
+	edge, ok := s.validateWorkAtParams(c, userKey, companyKey)
+	if !ok {
+		return
+	}
+
+	// validate payload
+	var params UpdateWorkAtParams
+	err := bindBody(c, &params)
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
+		return
+	}
+	if params.Position != "" {
+		params.Position = govalidator.Trim(params.Position, "")
+	}
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+	if params.Company != "" && params.Company != companyKey {
+		s.moveWorkAt(c, edge, params)
+		return
+	}
+
+	// validate the new period
+	var patch repositories.WorkAtPatch
+	since := edge.Since
+	until := edge.Until
+	if params.Since != "" {
+		since, _ = time.Parse(time.RFC3339, params.Since) // already validated
+		since = since.UTC()
+		patch.Since = &since
+	}
+	if params.Until != "" {
+		t, _ := time.Parse(time.RFC3339, params.Until)
+		t = t.UTC()
+		until = &t
+		patch.Until = until
+	}
+	if until != nil && !until.After(since) {
+		abortWithError(c, http.StatusBadRequest, errInvalidPeriod)
+		return
+	}
+
+	// update an edge
+	if params.Position != "" {
+		patch.Position = &params.Position
+	}
+	if params.Role != "" {
+		patch.Role = &params.Role
+	}
+	doc, err := s.Employment.Update(ctx, edge.Key, patch)
+	if err == repositories.ErrOverlapped {
+		abortWithError(c, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+// end the employment at the current company,
+// and start new one at other company from the same moment
+func (s *Server) moveWorkAt(c *gin.Context, edge *models.WorkAt, params UpdateWorkAtParams) {
+	ctx := context.Background()
+
+	// the same permission is required at the destination
+	err := s.validateVertex(ctx, "companies", params.Company)
+	if err != nil {
+		abortWithError(c, vertexErrorStatus(err), fmt.Errorf("company %w", err))
+		return
+	}
+	allowed, err := s.canManageCompany(c, params.Company)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if !allowed {
+		abortWithError(c, http.StatusForbidden, errPermissionDenied)
+		return
+	}
+
+	// validate the period
+	moment := time.Now().UTC()
+	if params.Since != "" {
+		moment, _ = time.Parse(time.RFC3339, params.Since) // already validated
+		moment = moment.UTC()
+	}
+	if !moment.After(edge.Since) {
+		abortWithError(c, http.StatusBadRequest, errInvalidPeriod)
+		return
+	}
+	var until *time.Time
+	if params.Until != "" {
+		t, _ := time.Parse(time.RFC3339, params.Until)
+		t = t.UTC()
+		until = &t
+	}
+	if until != nil && !until.After(moment) {
+		abortWithError(c, http.StatusBadRequest, errInvalidPeriod)
+		return
+	}
+
+	// perform an action
+	next := models.WorkAt{
+		From:     edge.From,
+		To:       "companies/" + params.Company,
+		Since:    moment,
+		Until:    until,
+		Position: edge.Position,
+		Role:     models.RoleMember, // being admin of one company is not carried to another
+	}
+	if params.Position != "" {
+		next.Position = params.Position
+	}
+	if params.Role != "" {
+		next.Role = params.Role
+	}
+	doc, err := s.Employment.Move(ctx, edge.Key, next)
+	if err == repositories.ErrOverlapped {
+		abortWithError(c, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, doc)
+}
+
+/*
+ * DELETE /companies/:key/employees/:user
+ * DELETE /users/:key/employers/:company
+ *
+ * End the current employment, or erase it from the history
+ */
+
+type DeleteWorkAtParams struct {
+	Mode  string `json:"mode" valid:"optional,in(end|erase)"`
+	Until string `json:"until" valid:"optional,rfc3339"`
+}
+
+func (s *Server) DeleteEmployee(c *gin.Context) {
+	s.deleteWorkAt(c, c.Param("user"), c.Param("key"))
+}
+
+func (s *Server) DeleteEmployer(c *gin.Context) {
+	s.deleteWorkAt(c, c.Param("key"), c.Param("company"))
+}
+
+func (s *Server) deleteWorkAt(c *gin.Context, userKey string, companyKey string) {
+	ctx := context.Background()
+
+	// validate params
+	edge, ok := s.validateWorkAtParams(c, userKey, companyKey)
+	if !ok {
+		return
+	}
+
+	// validate payload
+	var params DeleteWorkAtParams
+	err := bindBody(c, &params)
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
+		return
+	}
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// perform an action
+	if params.Mode == "erase" {
+		// delete an edge permanently
+		err = s.Employment.Erase(ctx, edge.Key)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusNoContent, "")
+	} else {
+		// keep an edge as the history
+		until := time.Now().UTC()
+		if params.Until != "" {
+			until, _ = time.Parse(time.RFC3339, params.Until) // already validated
+			until = until.UTC()
+		}
+		if !until.After(edge.Since) {
+			abortWithError(c, http.StatusBadRequest, errInvalidPeriod)
+			return
+		}
+		doc, err := s.Employment.Update(ctx, edge.Key, repositories.WorkAtPatch{
+			Until: &until,
+		})
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+// find the current edge between the user and the company,
+// and check whether current user can manage it.
+// the response is already sent when the result is false.
+func (s *Server) validateWorkAtParams(c *gin.Context, userKey string, companyKey string) (*models.WorkAt, bool) {
+	ctx := context.Background()
+	err := s.validateVertex(ctx, "users", userKey)
+	if err != nil {
+		abortWithError(c, vertexErrorStatus(err), fmt.Errorf("user %w", err))
+		return nil, false
+	}
+	err = s.validateVertex(ctx, "companies", companyKey)
+	if err != nil {
+		abortWithError(c, vertexErrorStatus(err), fmt.Errorf("company %w", err))
+		return nil, false
+	}
+	allowed, err := s.canManageCompany(c, companyKey)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if !allowed {
+		abortWithError(c, http.StatusForbidden, errPermissionDenied)
+		return nil, false
+	}
+	edge, err := s.Employment.Current(ctx, userKey, companyKey)
+	if err == repositories.ErrNotFound {
+		abortWithError(c, http.StatusNotFound, errNotEmployed)
+		return nil, false
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return edge, true
+}
+
+// a vertex of employment must exist and must not be trashed
+func (s *Server) validateVertex(ctx context.Context, collection string, key string) error {
+	var deletedAt *time.Time
+	if collection == "users" {
+		doc, err := s.Users.Get(ctx, key)
+		if err != nil {
+			return vertexError(err)
+		}
+		deletedAt = doc.DeletedAt
+	} else {
+		doc, err := s.Companies.Get(ctx, key)
+		if err != nil {
+			return vertexError(err)
+		}
+		deletedAt = doc.DeletedAt
+	}
+	if deletedAt != nil {
+		return errVertexTrashed
+	}
+	return nil
+}
+
+func vertexError(err error) error {
+	if err == repositories.ErrNotFound {
+		return errVertexNotFound
+	}
+	return err
+}
+
+func vertexErrorStatus(err error) int {
+	switch err {
+	case errVertexNotFound:
+		return http.StatusNotFound
+	case errVertexTrashed:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"groupware-gin/models"
+)
+
+func employeeNames(employees []models.Employee) []string {
+	names := []string{}
+	for _, employee := range employees {
+		names = append(names, employee.User.Name)
+	}
+	return names
+}
+
+func employerNames(employers []models.Employer) []string {
+	names := []string{}
+	for _, employer := range employers {
+		names = append(names, employer.Company.Name)
+	}
+	return names
+}
+
+func TestFindEmployees(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	bob := ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+	carol := ts.insertUser("Carol", "carol@example.com", models.RoleMember)
+	token := ts.token(alice)
+	acme := ts.insertCompany("Acme")
+	ts.insertWorkAt(bob, acme, models.RoleMember, "2020-01-01T00:00:00Z", "")
+	ts.insertWorkAt(alice, acme, models.RoleMember, "2021-01-01T00:00:00Z", "")
+	ts.insertWorkAt(carol, acme, models.RoleMember, "2010-01-01T00:00:00Z", "2015-01-01T00:00:00Z")
+
+	for query, want := range map[string][]string{
+		"":             {"Alice", "Bob"},
+		"?status=past": {"Carol"},
+		"?status=all":  {"Alice", "Bob", "Carol"},
+	} {
+		w := ts.request("GET", "/api/v1/companies/"+acme+"/employees"+query, token, "")
+		expectStatus(t, w, http.StatusOK)
+		var employees []models.Employee
+		decodeBody(t, w, &employees)
+		if got := employeeNames(employees); !equalStrings(got, want) {
+			t.Errorf("got %v by %q, want %v", got, query, want)
+		}
+	}
+
+	w := ts.request("GET", "/api/v1/companies/"+acme+"/employees?status=future", token, "")
+	expectError(t, w, http.StatusBadRequest, "validation_failed")
+	w = ts.request("GET", "/api/v1/companies/missing/employees", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
+
+func TestFindEmployers(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	token := ts.token(alice)
+	acme := ts.insertCompany("Acme")
+	globex := ts.insertCompany("Globex")
+	hooli := ts.insertCompany("Hooli")
+	ts.insertWorkAt(alice, hooli, models.RoleMember, "2021-01-01T00:00:00Z", "")
+	ts.insertWorkAt(alice, acme, models.RoleMember, "2010-01-01T00:00:00Z", "2015-01-01T00:00:00Z")
+	ts.insertWorkAt(alice, globex, models.RoleMember, "2015-01-01T00:00:00Z", "2021-01-01T00:00:00Z")
+
+	find := func(path string) []string {
+		t.Helper()
+		w := ts.request("GET", path, token, "")
+		expectStatus(t, w, http.StatusOK)
+		var employers []models.Employer
+		decodeBody(t, w, &employers)
+		return employerNames(employers)
+	}
+
+	if got := find("/api/v1/users/" + alice + "/employers"); !equalStrings(got, []string{"Hooli"}) {
+		t.Errorf("got %v", got)
+	}
+	if got := find("/api/v1/users/" + alice + "/employers?status=past"); !equalStrings(got, []string{"Acme", "Globex"}) {
+		t.Errorf("got %v of past", got)
+	}
+
+	// the career is ordered by time
+	if got := find("/api/v1/users/" + alice + "/career"); !equalStrings(got, []string{"Acme", "Globex", "Hooli"}) {
+		t.Errorf("got %v in career", got)
+	}
+
+	w := ts.request("GET", "/api/v1/users/missing/employers", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+	w = ts.request("GET", "/api/v1/users/missing/career", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
+
+func TestStoreEmployee(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	owner := ts.insertUser("Owner", "owner@example.com", models.RoleMember)
+	alice := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	trashed := ts.insertUser("Trashed", "trashed@example.com", models.RoleMember)
+	ts.trash("users", trashed)
+	acme := ts.insertCompany("Acme")
+	globex := ts.insertCompany("Globex")
+	ts.insertWorkAt(owner, acme, models.RoleAdmin, "2020-01-01T00:00:00Z", "")
+
+	w := ts.request("POST", "/api/v1/companies/"+acme+"/employees", admin, `{"user":"`+alice+`","since":"2020-01-01T00:00:00Z","until":"2021-01-01T00:00:00Z","position":" Engineer "}`)
+	expectStatus(t, w, http.StatusOK)
+	var edge models.WorkAt
+	decodeBody(t, w, &edge)
+	if edge.From != "users/"+alice || edge.To != "companies/"+acme || edge.Position != "Engineer" || edge.Role != models.RoleMember || edge.Until == nil {
+		t.Errorf("got %+v", edge)
+	}
+
+	t.Run("allows the company admin", func(t *testing.T) {
+		w := ts.request("POST", "/api/v1/companies/"+acme+"/employees", ts.token(owner), `{"user":"`+alice+`","since":"2022-01-01T00:00:00Z"}`)
+		expectStatus(t, w, http.StatusOK)
+		w = ts.request("POST", "/api/v1/companies/"+globex+"/employees", ts.token(owner), `{"user":"`+alice+`","since":"2022-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+	})
+
+	t.Run("stores from the user", func(t *testing.T) {
+		w := ts.request("POST", "/api/v1/users/"+alice+"/employers", admin, `{"company":"`+globex+`","since":"2022-01-01T00:00:00Z","role":"admin"}`)
+		expectStatus(t, w, http.StatusOK)
+		var edge models.WorkAt
+		decodeBody(t, w, &edge)
+		if edge.To != "companies/"+globex || edge.Role != models.RoleAdmin {
+			t.Errorf("got %+v", edge)
+		}
+	})
+
+	t.Run("rejects the overlap", func(t *testing.T) {
+		w := ts.request("POST", "/api/v1/companies/"+acme+"/employees", admin, `{"user":"`+alice+`","since":"2020-06-01T00:00:00Z","until":"2020-07-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusConflict, "employment_overlapped")
+		w = ts.request("POST", "/api/v1/users/"+alice+"/employers", admin, `{"company":"`+acme+`","since":"2023-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusConflict, "employment_overlapped")
+	})
+
+	t.Run("rejects the wrong requests", func(t *testing.T) {
+		w := ts.request("POST", "/api/v1/companies/"+acme+"/employees", admin, `{"user":"`+trashed+`","since":"2020-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusUnprocessableEntity, "vertex_trashed")
+		w = ts.request("POST", "/api/v1/companies/"+acme+"/employees", admin, `{"user":"missing","since":"2020-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusNotFound, "vertex_not_found")
+		w = ts.request("POST", "/api/v1/users/"+alice+"/employers", admin, `{"company":"missing","since":"2020-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusNotFound, "vertex_not_found")
+		w = ts.request("POST", "/api/v1/companies/"+globex+"/employees", admin, `{"user":"`+alice+`","since":"2020-01-01T00:00:00Z","until":"2019-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusBadRequest, "invalid_period")
+		w = ts.request("POST", "/api/v1/companies/"+globex+"/employees", admin, `{"user":"`+alice+`"}`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+		// bound like the other bodies
+		w = ts.request("POST", "/api/v1/companies/"+globex+"/employees", admin, `{"user":"`+alice+`","since":"2020-01-01T00:00:00Z","salary":1}`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+		w = ts.request("POST", "/api/v1/companies/"+globex+"/employees", admin, `user=x`, "Content-Type", "text/plain")
+		expectError(t, w, http.StatusUnsupportedMediaType, "unsupported_media_type")
+	})
+}
+
+func TestUpdateEmployee(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	alice := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	bob := ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+	acme := ts.insertCompany("Acme")
+	globex := ts.insertCompany("Globex")
+	ts.insertWorkAt(alice, acme, models.RoleMember, "2020-01-01T00:00:00Z", "")
+	ts.insertWorkAt(alice, acme, models.RoleMember, "2010-01-01T00:00:00Z", "2015-01-01T00:00:00Z")
+
+	w := ts.request("PATCH", "/api/v1/companies/"+acme+"/employees/"+alice, admin, `{"position":"Manager","role":"admin"}`)
+	expectStatus(t, w, http.StatusOK)
+	var edge models.WorkAt
+	decodeBody(t, w, &edge)
+	if edge.Position != "Manager" || edge.Role != models.RoleAdmin || edge.Since.Year() != 2020 {
+		t.Errorf("got %+v", edge)
+	}
+
+	t.Run("rejects the wrong changes", func(t *testing.T) {
+		w := ts.request("PATCH", "/api/v1/companies/"+acme+"/employees/"+alice, admin, `{"since":"2012-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusConflict, "employment_overlapped")
+		w = ts.request("PATCH", "/api/v1/companies/"+acme+"/employees/"+alice, admin, `{"until":"2019-01-01T00:00:00Z"}`)
+		expectError(t, w, http.StatusBadRequest, "invalid_period")
+		w = ts.request("PATCH", "/api/v1/companies/"+acme+"/employees/"+bob, admin, `{"position":"Manager"}`)
+		expectError(t, w, http.StatusNotFound, "not_employed")
+		w = ts.request("PATCH", "/api/v1/companies/"+acme+"/employees/"+alice, ts.token(bob), `{"position":"Nobody"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+	})
+
+	t.Run("moves to other company", func(t *testing.T) {
+		w := ts.request("PATCH", "/api/v1/users/"+alice+"/employers/"+acme, admin, `{"company":"`+globex+`","since":"2024-01-01T00:00:00Z"}`)
+		expectStatus(t, w, http.StatusOK)
+		var next models.WorkAt
+		decodeBody(t, w, &next)
+		if next.To != "companies/"+globex || next.Since.Year() != 2024 || next.Position != "Manager" || next.Role != models.RoleMember {
+			t.Errorf("got %+v", next)
+		}
+
+		w = ts.request("GET", "/api/v1/users/"+alice+"/career", admin, "")
+		expectStatus(t, w, http.StatusOK)
+		var career []models.Employer
+		decodeBody(t, w, &career)
+		if got := employerNames(career); !equalStrings(got, []string{"Acme", "Acme", "Globex"}) {
+			t.Fatalf("got %v", got)
+		}
+		if career[1].WorkAt.Until == nil || !career[1].WorkAt.Until.Equal(next.Since) {
+			t.Errorf("the previous employment ends at %v", career[1].WorkAt.Until)
+		}
+
+		w = ts.request("PATCH", "/api/v1/users/"+alice+"/employers/"+globex, admin, `{"company":"missing"}`)
+		expectError(t, w, http.StatusNotFound, "vertex_not_found")
+	})
+}
+
+func TestDeleteEmployee(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	alice := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	bob := ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+	acme := ts.insertCompany("Acme")
+	ts.insertWorkAt(alice, acme, models.RoleMember, "2020-01-01T00:00:00Z", "")
+	edge := ts.insertWorkAt(bob, acme, models.RoleMember, "2020-01-01T00:00:00Z", "")
+
+	w := ts.request("DELETE", "/api/v1/companies/"+acme+"/employees/"+alice, admin, `{"until":"2022-01-01T00:00:00Z"}`)
+	expectStatus(t, w, http.StatusOK)
+	var ended models.WorkAt
+	decodeBody(t, w, &ended)
+	if ended.Until == nil || ended.Until.Year() != 2022 {
+		t.Errorf("got %+v", ended)
+	}
+	w = ts.request("DELETE", "/api/v1/companies/"+acme+"/employees/"+alice, admin, "")
+	expectError(t, w, http.StatusNotFound, "not_employed")
+
+	w = ts.request("DELETE", "/api/v1/users/"+bob+"/employers/"+acme, admin, `{"until":"2019-01-01T00:00:00Z"}`)
+	expectError(t, w, http.StatusBadRequest, "invalid_period")
+	w = ts.request("DELETE", "/api/v1/users/"+bob+"/employers/"+acme, ts.token(bob), `{"mode":"erase"}`)
+	expectError(t, w, http.StatusForbidden, "permission_denied")
+	w = ts.request("DELETE", "/api/v1/users/"+bob+"/employers/"+acme, admin, `{"mode":"erase"}`)
+	expectStatus(t, w, http.StatusNoContent)
+	if _, err := ts.store.Document("work_at", edge); err == nil {
+		t.Errorf("the employment is kept")
+	}
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"groupware-gin/helpers"
+	"groupware-gin/locales"
+	"groupware-gin/models"
+	"groupware-gin/repositories"
+)
+
+var errValidationFailed = errors.New("validation failed")
+
+var (
+	errRouteNotFound    = errors.New("this route does not exist")
+	errMethodNotAllowed = errors.New("this method is not allowed on the route")
+)
+
+// the codes of the known errors, others have the code of their status.
+// The first match wins, so the specific errors come before the general ones.
+// The status of an error of the storage replaces 500 from the handler.
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{errValidationFailed, 0, "validation_failed"},
+	{errEmailUsed, 0, "unique_violation"},
+	{errCompanyNameUsed, 0, "unique_violation"},
+	{errPermissionDenied, 0, "permission_denied"},
+	{errInvalidCursor, 0, "invalid_cursor"},
+	{errPreconditionRequired, 0, "precondition_required"},
+	{errInvalidIfMatch, 0, "invalid_if_match"},
+	{errNotEmployed, 0, "not_employed"},
+	{errInvalidPeriod, 0, "invalid_period"},
+	{errVertexNotFound, 0, "vertex_not_found"},
+	{errVertexTrashed, 0, "vertex_trashed"},
+	{helpers.ErrInvalidToken, 0, "invalid_token"},
+	{helpers.ErrInvalidSignature, 0, "invalid_signature"},
+	{helpers.ErrSignatureExpired, 0, "signature_expired"},
+	{errNoAvatar, 0, "no_avatar"},
+	{errAvatarTooLarge, 0, "avatar_too_large"},
+	{repositories.ErrHasEmployment, http.StatusConflict, "has_employment"},
+	{repositories.ErrOverlapped, 0, "employment_overlapped"},
+	{repositories.ErrPreconditionFailed, http.StatusPreconditionFailed, "precondition_failed"},
+	{repositories.ErrConflict, http.StatusConflict, "conflict"},
+	{repositories.ErrNotFound, http.StatusNotFound, "not_found"},
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusUnprocessableEntity:   "unprocessable_entity",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "service_unavailable",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+}
+
+// the error number of ArangoDB for the unique index violation
+const arangoUniqueConstraintViolated = 1210
+
+// abortWithError stops the handlers, and RenderErrors responds the error later
+func abortWithError(c *gin.Context, status int, err error) {
+	c.Error(err).SetMeta(status)
+	c.Abort()
+}
+
+// RequestID passes X-Request-ID from the proxy, or makes a new one
+func RequestID() gin.HandlerFunc {
+	valid := regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !valid.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// NoRoute and NoMethod respond in the envelope instead of the plain text of Gin
+func NoRoute(c *gin.Context) {
+	abortWithError(c, http.StatusNotFound, errRouteNotFound)
+}
+
+func NoMethod(c *gin.Context) {
+	abortWithError(c, http.StatusMethodNotAllowed, errMethodNotAllowed)
+}
+
+// RenderErrors responds the last error of the handlers in the envelope,
+// the internal errors are logged and their messages are hidden
+func RenderErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		last := c.Errors.Last()
+		status, ok := last.Meta.(int)
+		if !ok {
+			status = http.StatusInternalServerError
+		}
+		lang := locales.Negotiate(c.GetHeader("Accept-Language"))
+		status, body := errorResponse(lang, status, last.Err)
+		c.Header("Content-Language", lang)
+		body.RequestID = c.GetString("request_id")
+		if status >= http.StatusInternalServerError {
+			log.Printf("Error in %s %s [%s] %v\n", c.Request.Method, c.Request.URL.Path, body.RequestID, last.Err)
+		}
+		c.JSON(status, body)
+	}
+}
+
+func errorResponse(lang string, status int, err error) (int, models.Error) {
+	body := models.Error{
+		Message: err.Error(),
+	}
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			body.Code = known.code
+			if status == http.StatusInternalServerError && known.status != 0 {
+				status = known.status
+			}
+			break
+		}
+	}
+
+	// the errors of ArangoDB that the repositories pass through
+	if body.Code == "" && status == http.StatusInternalServerError {
+		switch {
+		case driver.IsNotFound(err):
+			status = http.StatusNotFound
+		case driver.IsPreconditionFailed(err):
+			status = http.StatusPreconditionFailed
+		case driver.IsConflict(err):
+			status = http.StatusConflict
+			if driver.IsArangoErrorWithErrorNum(err, arangoUniqueConstraintViolated) {
+				return status, models.Error{Code: "unique_violation", Message: "this value is already used"}
+			}
+			return status, models.Error{Code: "conflict", Message: "this document conflicts with another one"}
+		}
+	}
+
+	if body.Code == "" {
+		body.Code = statusCodes[status]
+	}
+	if body.Code == "" {
+		body.Code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+
+	var validationError *ValidationError
+	var filterError *FilterError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case status >= http.StatusInternalServerError:
+		body.Message = http.StatusText(status) // never leak the internals
+	case errors.As(err, &validationError):
+		body.Code = "validation_failed"
+		body.Message = locales.Message(lang, "validation_failed")
+		body.Details = validationError.Details(lang)
+	case errors.As(err, &filterError):
+		body.Code = "invalid_filter"
+		body.Details = []models.FieldError{{Field: "filter[" + filterError.Field + "]", Message: filterError.Message}}
+	case errors.As(err, &syntaxError), errors.As(err, &typeError), strings.HasPrefix(err.Error(), "json: unknown field"):
+		body.Code = "invalid_json"
+	}
+	return status, body
+}
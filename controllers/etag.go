@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"groupware-gin/repositories"
+)
+
+var (
+	errPreconditionRequired = errors.New("If-Match header is required, get the ETag first")
+	errInvalidIfMatch       = errors.New("If-Match must be * or one quoted ETag")
+)
+
+// setETag exposes the revision of the document as a strong entity tag
+func setETag(c *gin.Context, rev string) {
+	if rev != "" {
+		c.Header("ETag", `"`+rev+`"`)
+	}
+}
+
+// ifMatch returns the revision in If-Match that the document must still have,
+// or empty string for any revision.
+// REQUIRE_IF_MATCH rejects the writes without it.
+func (s *Server) ifMatch(c *gin.Context) (string, error) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		if s.RequireIfMatch {
+			return "", errPreconditionRequired
+		}
+		return "", nil
+	}
+	if header == "*" {
+		return "", nil
+	}
+	if strings.HasPrefix(header, "W/") {
+		// If-Match uses the strong comparison, so a weak tag never matches
+		return "", repositories.ErrPreconditionFailed
+	}
+	if len(header) < 3 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) || strings.Contains(header, ",") {
+		return "", errInvalidIfMatch
+	}
+	return header[1 : len(header)-1], nil
+}
+
+func preconditionStatus(err error) int {
+	switch err {
+	case errPreconditionRequired:
+		return http.StatusPreconditionRequired
+	case errInvalidIfMatch:
+		return http.StatusBadRequest
+	case repositories.ErrPreconditionFailed:
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// notModified sets the validators of the document,
+// and reports whether the client has the same one already.
+// If-Modified-Since is used only without If-None-Match.
+func notModified(c *gin.Context, rev string, updatedAt time.Time) bool {
+	setETag(c, rev)
+	if !updatedAt.IsZero() {
+		c.Header("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
+	}
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		return matchETag(header, `"`+rev+`"`)
+	}
+	if header := c.GetHeader("If-Modified-Since"); header != "" && !updatedAt.IsZero() {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return false // ignore the invalid date
+		}
+		// the header has only seconds
+		return !updatedAt.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// jsonWithETag responds the list with a weak ETag from the hash of its content,
+// or 304 Not Modified if If-None-Match has the same one
+func jsonWithETag(c *gin.Context, body interface{}) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	sum := sha256.Sum256(buf)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	if header := c.GetHeader("If-None-Match"); header != "" && matchETag(header, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", buf)
+}
+
+// matchETag compares If-None-Match with the weak comparison,
+// that ignores the W/ prefix
+func matchETag(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.TrimPrefix(item, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
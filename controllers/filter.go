@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"groupware-gin/repositories"
+)
+
+// the type of a field decides the operators and how values are compared
+const (
+	fieldString = "string"
+	fieldEmail  = "email" // a string stored in lower case
+	fieldTime   = "time"
+)
+
+var filterOperators = map[string][]string{
+	fieldString: {"eq", "ne", "in", "contains", "starts_with", "ends_with"},
+	fieldEmail:  {"eq", "ne", "in", "contains", "starts_with", "ends_with"},
+	fieldTime:   {"eq", "ne", "gt", "gte", "lt", "lte"},
+}
+
+var userFilterFields = map[string]string{
+	"name":       fieldString,
+	"email":      fieldEmail,
+	"role":       fieldString,
+	"created_at": fieldTime,
+	"updated_at": fieldTime,
+	"deleted_at": fieldTime,
+}
+
+var companyFilterFields = map[string]string{
+	"name":       fieldString,
+	"since":      fieldTime,
+	"created_at": fieldTime,
+	"updated_at": fieldTime,
+	"deleted_at": fieldTime,
+}
+
+type FilterError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *FilterError) Error() string {
+	return "filter[" + e.Field + "]: " + e.Message
+}
+
+// parseFilter validates the query like filter[since][gte]=2015-01-01,
+// that qson decodes into {"since": {"gte": "2015-01-01"}}.
+// filter[name]=foo is the short form of filter[name][eq]=foo.
+func parseFilter(raw map[string]interface{}, fields map[string]string) ([]repositories.Condition, error) {
+	conditions := []repositories.Condition{}
+	for field, item := range raw {
+		fieldType, found := fields[field]
+		if !found {
+			return nil, &FilterError{Field: field, Message: "unknown field"}
+		}
+		operations, ok := item.(map[string]interface{})
+		if !ok {
+			operations = map[string]interface{}{"eq": item}
+		}
+		for operator, value := range operations {
+			if !isAllowedField(operator, filterOperators[fieldType]) {
+				return nil, &FilterError{Field: field, Message: "unsupported operator " + operator}
+			}
+			converted, err := convertFilterValue(fieldType, operator, value)
+			if err != nil {
+				return nil, &FilterError{Field: field, Message: err.Error()}
+			}
+			conditions = append(conditions, repositories.Condition{
+				Field:    field,
+				Operator: operator,
+				Value:    converted,
+			})
+		}
+	}
+
+	// keep the query same for the same filter
+	sort.Slice(conditions, func(i, j int) bool {
+		if conditions[i].Field != conditions[j].Field {
+			return conditions[i].Field < conditions[j].Field
+		}
+		return conditions[i].Operator < conditions[j].Operator
+	})
+	return conditions, nil
+}
+
+func convertFilterValue(fieldType string, operator string, value interface{}) (interface{}, error) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case float64: // qson decodes numeric values
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		return nil, fmt.Errorf("invalid value for %s", operator)
+	}
+	if fieldType == fieldTime {
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			t, err := time.Parse(layout, text)
+			if err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date %q, use RFC3339 or YYYY-MM-DD", text)
+	}
+	if fieldType == fieldEmail {
+		text = strings.ToLower(text)
+	}
+	if operator == "in" {
+		items := strings.Split(text, ",")
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
+		}
+		return items, nil
+	}
+	return text, nil
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"groupware-gin/models"
+)
+
+const defaultPageLimit = 20
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// the cursor is opaque for clients, so its content can change later
+type pageCursor struct {
+	Offset int `json:"o"`
+}
+
+func encodeCursor(offset int) string {
+	buf, _ := json.Marshal(pageCursor{Offset: offset})
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodeCursor(cursor string) (int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	var result pageCursor
+	err = json.Unmarshal(buf, &result)
+	if err != nil || result.Offset < 0 {
+		return 0, errInvalidCursor
+	}
+	return result.Offset, nil
+}
+
+// pageWindow returns the offset and limit from either cursor or offset param
+func pageWindow(cursor string, offset *int, limit *int) (int, int, error) {
+	resultLimit := defaultPageLimit
+	if limit != nil {
+		resultLimit = *limit
+	}
+	if cursor != "" && offset != nil {
+		return 0, 0, errors.New("cursor and offset cannot be used together")
+	}
+	if cursor != "" {
+		resultOffset, err := decodeCursor(cursor)
+		return resultOffset, resultLimit, err
+	}
+	if offset != nil {
+		return *offset, resultLimit, nil
+	}
+	return 0, resultLimit, nil
+}
+
+// newPage wraps the data with the total count,
+// and sets the Link header to the previous and next pages
+func newPage(c *gin.Context, data interface{}, total int64, offset int, limit int) models.Page {
+	page := models.Page{
+		Data:   data,
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	}
+	links := []string{}
+	if int64(offset+limit) < total {
+		page.NextCursor = encodeCursor(offset + limit)
+		links = append(links, "<"+pageURL(c, page.NextCursor)+">; rel=\"next\"")
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.PrevCursor = encodeCursor(prev)
+		links = append(links, "<"+pageURL(c, page.PrevCursor)+">; rel=\"prev\"")
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+	return page
+}
+
+// the same request URL except the page position
+func pageURL(c *gin.Context, cursor string) string {
+	query := c.Request.URL.Query()
+	query.Del("offset")
+	query.Set("cursor", cursor)
+	u := url.URL{
+		Path:     c.Request.URL.Path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"groupware-gin/helpers"
+	"groupware-gin/repositories"
+)
+
+type PurgeSummary struct {
+	Users     int `json:"users"`
+	Companies int `json:"companies"`
+	Edges     int `json:"edges"`
+}
+
+// trashed documents are kept for 30 days unless TRASH_RETENTION is set
+func TrashRetention() (time.Duration, error) {
+	return helpers.EnvDuration("TRASH_RETENTION", 30*24*time.Hour)
+}
+
+// StartPurger erases the expired trash periodically in background,
+// TRASH_PURGE_INTERVAL=0 disables it
+func (s *Server) StartPurger() error {
+	retention, err := TrashRetention()
+	if err != nil {
+		return err
+	}
+	interval, err := helpers.EnvDuration("TRASH_PURGE_INTERVAL", time.Hour)
+	if err != nil {
+		return err
+	}
+	if interval <= 0 {
+		return nil
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			_, err := s.PurgeTrash(retention)
+			if err != nil {
+				log.Printf("Error purging trash %v\n", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// PurgeTrash erases the users and companies trashed before the retention period,
+// with their avatars and the edges that point to them
+func (s *Server) PurgeTrash(retention time.Duration) (*PurgeSummary, error) {
+	ctx := context.Background()
+	cutoff := time.Now().Add(-retention).UTC()
+	summary := &PurgeSummary{}
+
+	// users, from the first page again because the erased ones leave it
+	for {
+		users, _, err := s.Users.List(ctx, expiredTrash(cutoff))
+		if err != nil {
+			return summary, err
+		}
+		if len(users) == 0 {
+			break
+		}
+		for _, user := range users {
+			count, err := s.Users.Erase(ctx, user.Key, "", repositories.CascadeDelete)
+			if err != nil {
+				return summary, err
+			}
+			err = s.Storage.DeletePrefix(ctx, "users/"+user.Key)
+			if err != nil {
+				// the user is erased already, so only the files are left behind
+				log.Printf("Error removing the files of user %s %v\n", user.Key, err)
+			}
+			summary.Edges += count
+			summary.Users++
+		}
+	}
+
+	// companies
+	for {
+		companies, _, err := s.Companies.List(ctx, expiredTrash(cutoff))
+		if err != nil {
+			return summary, err
+		}
+		if len(companies) == 0 {
+			break
+		}
+		for _, company := range companies {
+			count, err := s.Companies.Erase(ctx, company.Key, "", repositories.CascadeDelete)
+			if err != nil {
+				return summary, err
+			}
+			summary.Edges += count
+			summary.Companies++
+		}
+	}
+
+	// the edges left behind by erasing before this purger existed
+	count, err := s.Employment.RemoveDangling(ctx)
+	if err != nil {
+		return summary, err
+	}
+	summary.Edges += count
+
+	log.Printf(
+		"Purged the trash before %s: %d users, %d companies, %d edges\n",
+		cutoff.Format(time.RFC3339), summary.Users, summary.Companies, summary.Edges,
+	)
+	return summary, nil
+}
+
+// expiredTrash selects a page of the documents trashed before the cutoff
+func expiredTrash(cutoff time.Time) repositories.ListOptions {
+	return repositories.ListOptions{
+		Filter: []repositories.Condition{
+			{Field: "deleted_at", Operator: "lt", Value: cutoff},
+		},
+		Limit:       100,
+		OnlyTrashed: true,
+	}
+}
@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joncalhoun/qson"
+
+	"groupware-gin/repositories"
+)
+
+/*
+ * GET /search
+ *
+ * Find users and companies by words, ranked by relevance
+ */
+
+// qson decodes a numeric value as number, but the search query is always text
+type searchQuery string
+
+func (q *searchQuery) UnmarshalJSON(data []byte) error {
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		text = string(data)
+	}
+	*q = searchQuery(text)
+	return nil
+}
+
+type SearchParams struct {
+	Q      searchQuery `json:"q" valid:"-"`
+	Type   string      `json:"type" valid:"optional,in(user|company)"`
+	Limit  *int        `json:"limit" valid:"optional,range(5|100)"`
+	Offset *int        `json:"offset" valid:"optional,range(0|1000000)"`
+	Cursor string      `json:"cursor" valid:"optional"`
+}
+
+func (s *Server) Search(c *gin.Context) {
+	ctx := context.Background()
+
+	// validate URL query
+	var params SearchParams
+	if c.Request.URL.RawQuery != "" { // hack: qson fails on empty string
+		err := qson.Unmarshal(&params, c.Request.URL.RawQuery)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+		err = validate(params)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+	q := strings.TrimSpace(string(params.Q))
+	if q == "" {
+		abortWithError(c, http.StatusBadRequest, fieldInvalid("q", "required"))
+		return
+	}
+	offset, limit, err := pageWindow(params.Cursor, params.Offset, params.Limit)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// make a result
+	results, total, err := s.SearchIndex.Search(ctx, repositories.SearchOptions{
+		Query:  q,
+		Type:   params.Type,
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	jsonWithETag(c, newPage(c, results, total, offset, limit))
+}
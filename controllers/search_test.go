@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"groupware-gin/models"
+)
+
+type searchPage struct {
+	Data []struct {
+		Type     string          `json:"type"`
+		Score    float64         `json:"score"`
+		Document json.RawMessage `json:"document"`
+	} `json:"data"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func TestSearch(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token(ts.insertUser("Alice Acme", "alice@example.com", models.RoleMember))
+	ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+	ts.insertCompany("Acme")
+	ts.insertCompany("Acmeco")
+	ts.trash("companies", ts.insertCompany("Acme Trashed"))
+
+	search := func(query string) searchPage {
+		t.Helper()
+		w := ts.request("GET", "/api/v1/search"+query, token, "")
+		expectStatus(t, w, http.StatusOK)
+		var page searchPage
+		decodeBody(t, w, &page)
+		return page
+	}
+
+	page := search("?q=acme")
+	if page.Total != 3 {
+		t.Fatalf("got %+v", page)
+	}
+	for i := 1; i < len(page.Data); i++ {
+		if page.Data[i].Score > page.Data[i-1].Score {
+			t.Errorf("the results are not ranked: %+v", page.Data)
+		}
+	}
+	var company models.Company
+	json.Unmarshal(page.Data[len(page.Data)-1].Document, &company)
+	if company.Name != "Acmeco" {
+		t.Errorf("the prefix match is ranked before the exact ones: %+v", page.Data)
+	}
+
+	page = search("?q=acme&type=user")
+	if page.Total != 1 || page.Data[0].Type != "user" {
+		t.Errorf("got %+v by type", page)
+	}
+
+	w := ts.request("GET", "/api/v1/search?q=%20", token, "")
+	expectError(t, w, http.StatusBadRequest, "validation_failed")
+	w = ts.request("GET", "/api/v1/search?q=acme&type=robot", token, "")
+	expectError(t, w, http.StatusBadRequest, "validation_failed")
+}
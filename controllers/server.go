@@ -2,24 +2,41 @@ package controllers
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"os"
-	"path"
-	"path/filepath"
+	"sync"
 	"time"
 
 	driver "github.com/arangodb/go-driver"
 	"github.com/asaskevich/govalidator"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
+	"groupware-gin/blobs"
 	"groupware-gin/helpers"
+	"groupware-gin/migrations"
+	"groupware-gin/repositories"
 )
 
 type Server struct {
 	DB     driver.Database
 	Router *gin.Engine
+	Hasher helpers.PasswordHasher
+	Tokens *helpers.TokenSigner
+	URLs   *helpers.URLSigner
+
+	RequireIfMatch bool // reject the writes without If-Match
+
+	Companies     repositories.CompanyRepository
+	Users         repositories.UserRepository
+	Employment    repositories.EmploymentRepository
+	RefreshTokens repositories.TokenRepository
+	SearchIndex   repositories.SearchRepository
+	Storage       blobs.BlobStore // the uploaded files
+
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
 func (s *Server) Initialize() error {
@@ -28,9 +45,67 @@ func (s *Server) Initialize() error {
 		return err
 	}
 	s.DB = db
+	s.SetUpRepositories()
+	hasher, err := helpers.NewPasswordHasher()
+	if err != nil {
+		return err
+	}
+	s.Hasher = hasher
+	tokens, err := helpers.NewTokenSigner()
+	if err != nil {
+		return err
+	}
+	s.Tokens = tokens
+	s.URLs, err = helpers.NewURLSigner()
+	if err != nil {
+		return err
+	}
+	s.Storage, err = blobs.NewBlobStore()
+	if err != nil {
+		return err
+	}
+	_, err = DefaultCascade() // fail fast on wrong config
+	if err != nil {
+		return err
+	}
+	_, err = AvatarMaxSize()
+	if err != nil {
+		return err
+	}
+	_, err = ThumbnailSizes()
+	if err != nil {
+		return err
+	}
+	s.RequireIfMatch, err = helpers.EnvBool("REQUIRE_IF_MATCH", false)
+	if err != nil {
+		return err
+	}
+	err = s.Migrate()
+	if err != nil {
+		return err
+	}
+	err = s.StartPurger()
+	if err != nil {
+		return err
+	}
+	s.SetUpRouter()
+	return nil
+}
+
+// SetUpRouter makes the router with the middlewares and the routes,
+// the repositories, the signers and the storage must be set already
+func (s *Server) SetUpRouter() {
 	s.Router = gin.Default()
 	s.SetUpCors()
+	s.Router.Use(RequestID(), RenderErrors())
+	s.Router.HandleMethodNotAllowed = true
+	s.Router.NoRoute(NoRoute)
+	s.Router.NoMethod(NoMethod)
 	s.SetUpRoutes()
+	s.SetUpValidators()
+}
+
+func (s *Server) SetUpValidators() {
 	// extend validator for password confirmation
 	govalidator.CustomTypeTagMap.Set("store_confirmed", govalidator.CustomTypeValidator(func(i, o interface{}) bool {
 		result := i.(string) == o.(StoreUserParams).PasswordConfirmation
@@ -40,7 +115,34 @@ func (s *Server) Initialize() error {
 		result := i.(string) == o.(UpdateUserParams).PasswordConfirmation
 		return result
 	}))
-	return nil
+}
+
+// SetUpRepositories makes the repositories on the opened database
+func (s *Server) SetUpRepositories() {
+	s.Companies = repositories.NewArangoCompanyRepository(s.DB)
+	s.Users = repositories.NewArangoUserRepository(s.DB)
+	s.Employment = repositories.NewArangoEmploymentRepository(s.DB)
+	s.RefreshTokens = repositories.NewArangoTokenRepository(s.DB)
+	s.SearchIndex = repositories.NewArangoSearchRepository(s.DB)
+}
+
+// SetUpMemoryRepositories makes the repositories on the memory store instead of the database,
+// so the handlers run without ArangoDB in the tests
+func (s *Server) SetUpMemoryRepositories(m *repositories.MemoryStore) {
+	s.Companies = m.Companies()
+	s.Users = m.Users()
+	s.Employment = m.Employment()
+	s.RefreshTokens = m.RefreshTokens()
+	s.SearchIndex = m.Search()
+}
+
+// Migrate applies the pending migrations, so the server never runs on an outdated schema
+func (s *Server) Migrate() error {
+	done, err := migrations.Up(context.Background(), s.DB)
+	for _, migration := range done {
+		log.Printf("Applied migration %04d %s\n", migration.Version, migration.Name)
+	}
+	return err
 }
 
 func (s *Server) SetUpCors() {
@@ -54,8 +156,8 @@ func (s *Server) SetUpCors() {
 			cors.Config{
 				AllowOrigins:     []string{os.Getenv("ORIGIN_ALLOWED")},
 				AllowMethods:     []string{"GET", "POST", "PATCH", "DELETE"},
-				AllowHeaders:     []string{"Origin"},
-				ExposeHeaders:    []string{"Content-Length"},
+				AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "If-Match", "If-None-Match", "If-Modified-Since", "X-Request-ID"},
+				ExposeHeaders:    []string{"Content-Length", "ETag", "Last-Modified", "Link", "X-Request-ID"},
 				AllowCredentials: true,
 				AllowOriginFunc: func(origin string) bool {
 					return origin == "https://github.com"
@@ -74,68 +176,41 @@ func (s *Server) SetUpRoutes() {
 		})
 	})
 
-	// companies routes
-	apiGroup.GET("/companies", s.FindCompanies)
-	apiGroup.GET("/companies/:key", s.ShowCompany)
-	apiGroup.POST("/companies", s.StoreCompany)
-	apiGroup.PATCH("/companies/:key", s.UpdateCompany)
-	apiGroup.DELETE("/companies/:key", s.DeleteCompany)
+	// auth routes
+	apiGroup.POST("/auth/login", s.Login)
+	apiGroup.POST("/auth/refresh", s.Refresh)
+	apiGroup.POST("/auth/logout", s.Logout)
 
-	// users routes
-	apiGroup.GET("/users", s.FindUsers)
-	apiGroup.GET("/users/:key", s.ShowUser)
-	apiGroup.POST("/users", s.StoreUser)
-	apiGroup.PATCH("/users/:key", s.UpdateUser)
-	apiGroup.DELETE("/users/:key", s.DeleteUser)
-}
+	// the following routes require an access token
+	authGroup := apiGroup.Group("/", s.Authenticate())
 
-func (s *Server) HasCollection(name string) (bool, error) {
-	ctx := context.Background()
-	collections, err := s.DB.Collections(ctx)
-	if err != nil {
-		return false, err
-	}
-	for _, c := range collections {
-		if c.Name() == name {
-			return true, nil
-		}
-	}
-	return false, nil
-}
+	// search users and companies together
+	authGroup.GET("/search", s.Search)
 
-func IsDir(dirPath string) bool {
-	pathAbs, err := filepath.Abs(dirPath)
-	if err != nil {
-		return false
-	}
-	fileInfo, err := os.Stat(pathAbs)
-	if os.IsNotExist(err) {
-		return false
-	}
-	if !fileInfo.IsDir() {
-		return false
-	}
-	return true
-}
+	// companies routes
+	authGroup.GET("/companies", s.FindCompanies)
+	authGroup.GET("/companies/:key", s.ShowCompany)
+	authGroup.POST("/companies", s.RequireSystemAdmin(), s.StoreCompany)
+	authGroup.PATCH("/companies/:key", s.UpdateCompany)
+	authGroup.DELETE("/companies/:key", s.DeleteCompany)
+	authGroup.GET("/companies/:key/employees", s.FindEmployees)
+	authGroup.POST("/companies/:key/employees", s.StoreEmployee)
+	authGroup.PATCH("/companies/:key/employees/:user", s.UpdateEmployee)
+	authGroup.DELETE("/companies/:key/employees/:user", s.DeleteEmployee)
 
-func AcceptFile(c *gin.Context, fieldName string, destDir string) (string, error) {
-	file, err := c.FormFile(fieldName)
-	if err != nil {
-		return "", err
-	}
-	if file == nil {
-		return "", nil
-	}
-	if !IsDir(destDir) {
-		err = os.MkdirAll(destDir, os.ModePerm)
-		if err != nil {
-			return "", err
-		}
-	}
-	fileName := uuid.New().String() + filepath.Ext(file.Filename)
-	err = c.SaveUploadedFile(file, path.Join(destDir, fileName))
-	if err != nil {
-		return fileName, err
-	}
-	return fileName, nil
+	// users routes
+	authGroup.GET("/users", s.FindUsers)
+	authGroup.GET("/users/:key", s.ShowUser)
+	authGroup.POST("/users", s.RequireSystemAdmin(), s.StoreUser)
+	authGroup.PATCH("/users/:key", s.UpdateUser)
+	authGroup.DELETE("/users/:key", s.DeleteUser)
+	authGroup.GET("/users/:key/employers", s.FindEmployers)
+	authGroup.GET("/users/:key/career", s.ShowCareer)
+	authGroup.GET("/users/:key/colleagues", s.FindColleagues)
+	authGroup.GET("/users/:key/connections", s.FindConnections)
+	authGroup.GET("/users/:key/avatar/url", s.SignAvatarURL)
+	apiGroup.GET("/users/:key/avatar", s.AuthenticateOrSigned(), s.ShowAvatar) // also by the signed URL
+	authGroup.POST("/users/:key/employers", s.StoreEmployer)
+	authGroup.PATCH("/users/:key/employers/:company", s.UpdateEmployer)
+	authGroup.DELETE("/users/:key/employers/:company", s.DeleteEmployer)
 }
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"groupware-gin/blobs"
+	"groupware-gin/helpers"
+	"groupware-gin/models"
+	"groupware-gin/repositories"
+)
+
+const testPassword = "secret1"
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard // the access log of gin.Default
+	os.Setenv("ORIGIN_ALLOWED", "https://example.com")
+	os.Exit(m.Run())
+}
+
+// testServer runs the handlers on the memory store and a temporary directory,
+// like Initialize without the database and the environment
+type testServer struct {
+	*Server
+	t     *testing.T
+	store *repositories.MemoryStore
+	hash  string // of testPassword
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s := &Server{
+		Hasher: &helpers.BcryptHasher{Cost: 4}, // the minimum cost for speed
+		Tokens: &helpers.TokenSigner{
+			Secret:     []byte("test secret"),
+			AccessTTL:  15 * time.Minute,
+			RefreshTTL: time.Hour,
+		},
+		URLs: &helpers.URLSigner{
+			Secret: []byte("test url secret"),
+			TTL:    time.Hour,
+		},
+		Storage: blobs.NewLocalStore(t.TempDir()),
+	}
+	store := repositories.NewMemoryStore()
+	s.SetUpMemoryRepositories(store)
+	s.SetUpRouter()
+	hash, err := s.Hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{Server: s, t: t, store: store, hash: hash}
+}
+
+// insert makes a raw document, and returns its key
+func (ts *testServer) insert(collection string, data map[string]interface{}) string {
+	ts.t.Helper()
+	doc, err := ts.store.Insert(collection, data)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return doc["_key"].(string)
+}
+
+func (ts *testServer) insertUser(name string, email string, role string) string {
+	ts.t.Helper()
+	now := time.Now().UTC()
+	return ts.insert("users", map[string]interface{}{
+		"name":       name,
+		"email":      email,
+		"password":   ts.hash,
+		"role":       role,
+		"created_at": now,
+		"updated_at": now,
+	})
+}
+
+func (ts *testServer) insertCompany(name string) string {
+	ts.t.Helper()
+	now := time.Now().UTC()
+	return ts.insert("companies", map[string]interface{}{
+		"name":       name,
+		"name_lower": strings.ToLower(name),
+		"since":      time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		"created_at": now,
+		"updated_at": now,
+	})
+}
+
+// insertWorkAt makes the employment since the date, and until the other one if not empty
+func (ts *testServer) insertWorkAt(userKey string, companyKey string, role string, since string, until string) string {
+	ts.t.Helper()
+	data := map[string]interface{}{
+		"_from":    "users/" + userKey,
+		"_to":      "companies/" + companyKey,
+		"since":    since,
+		"position": "",
+		"role":     role,
+	}
+	if until != "" {
+		data["until"] = until
+	}
+	return ts.insert("work_at", data)
+}
+
+// trash marks the document as trashed like the trash mode of DELETE
+func (ts *testServer) trash(collection string, key string) {
+	ts.t.Helper()
+	var err error
+	if collection == "users" {
+		_, err = ts.Users.Trash(context.Background(), key, "")
+	} else {
+		_, err = ts.Companies.Trash(context.Background(), key, "")
+	}
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func (ts *testServer) token(userKey string) string {
+	ts.t.Helper()
+	token, _, err := ts.Tokens.SignAccessToken(userKey)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return token
+}
+
+// request sends the body as JSON unless it is empty,
+// the headers are pairs of name and value
+func (ts *testServer) request(method string, path string, token string, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return ts.send(req, token, headers...)
+}
+
+// upload sends the fields and the avatar as multipart form
+func (ts *testServer) upload(method string, path string, token string, fields map[string]string, avatar []byte) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	if avatar != nil {
+		part, err := form.CreateFormFile("avatar", "avatar.png")
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		part.Write(avatar)
+	}
+	form.Close()
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return ts.send(req, token)
+}
+
+func (ts *testServer) send(req *http.Request, token string, headers ...string) *httptest.ResponseRecorder {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	ts.Router.ServeHTTP(w, req)
+	return w
+}
+
+// expectStatus fails the test with the body, that has the error code
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("got status %d, want %d: %s", w.Code, status, w.Body.String())
+	}
+}
+
+func expectError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	expectStatus(t, w, status)
+	var body models.Error
+	decodeBody(t, w, &body)
+	if body.Code != code {
+		t.Fatalf("got error code %q, want %q: %s", body.Code, code, w.Body.String())
+	}
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(w.Body.Bytes(), v)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	ts := newTestServer(t)
+
+	w := ts.request("GET", "/api/v1/ping", "", "")
+	expectStatus(t, w, http.StatusOK)
+	var body map[string]string
+	decodeBody(t, w, &body)
+	if body["message"] != "ping" {
+		t.Errorf("got %v", body)
+	}
+	if w.Header().Get("X-Request-ID") == "" {
+		t.Errorf("no X-Request-ID")
+	}
+}
+
+func TestUnknownRoute(t *testing.T) {
+	ts := newTestServer(t)
+
+	w := ts.request("GET", "/api/v1/nothing", "", "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+	if w.Header().Get("X-Request-ID") == "" {
+		t.Errorf("the unknown route has no request id")
+	}
+	w = ts.request("PUT", "/api/v1/auth/login", "", "")
+	expectError(t, w, http.StatusMethodNotAllowed, "method_not_allowed")
+}
+
+// bothErrors matches two known errors, like a vertex error wrapping the storage one
+type bothErrors struct{ first, second error }
+
+func (e bothErrors) Error() string        { return e.first.Error() }
+func (e bothErrors) Is(target error) bool { return target == e.first || target == e.second }
+
+func TestErrorResponse(t *testing.T) {
+	for _, test := range []struct {
+		status     int
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{http.StatusInternalServerError, fmt.Errorf("get: %w", repositories.ErrNotFound), http.StatusNotFound, "not_found"},
+		{http.StatusInternalServerError, repositories.ErrHasEmployment, http.StatusConflict, "has_employment"},
+		{http.StatusInternalServerError, repositories.ErrPreconditionFailed, http.StatusPreconditionFailed, "precondition_failed"},
+		{http.StatusUnprocessableEntity, fmt.Errorf("user %w", errVertexTrashed), http.StatusUnprocessableEntity, "vertex_trashed"},
+		{http.StatusNotFound, bothErrors{errVertexNotFound, repositories.ErrNotFound}, http.StatusNotFound, "vertex_not_found"},
+		{http.StatusNotFound, bothErrors{repositories.ErrNotFound, errVertexNotFound}, http.StatusNotFound, "vertex_not_found"},
+		{http.StatusBadRequest, errors.New("bad"), http.StatusBadRequest, "bad_request"},
+		{http.StatusInternalServerError, errors.New("secret"), http.StatusInternalServerError, "internal_error"},
+	} {
+		// the same every time, the order of a map would not be
+		for i := 0; i < 10; i++ {
+			status, body := errorResponse("en", test.status, test.err)
+			if status != test.wantStatus || body.Code != test.wantCode {
+				t.Fatalf("got %d %q for %v, want %d %q", status, body.Code, test.err, test.wantStatus, test.wantCode)
+			}
+			if status >= http.StatusInternalServerError && body.Message == test.err.Error() {
+				t.Fatalf("the internal message is leaked: %q", body.Message)
+			}
+		}
+	}
+}
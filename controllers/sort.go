@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+
+	"groupware-gin/repositories"
+)
+
+// parseSort validates the sort param like "-name,email",
+// each field must be in the whitelist so it can be put into the query safely.
+func parseSort(sort string, allowed []string) ([]repositories.SortKey, error) {
+	keys := []repositories.SortKey{}
+	used := map[string]bool{}
+	if sort == "" {
+		return keys, nil
+	}
+	for _, item := range strings.Split(sort, ",") {
+		item = strings.TrimSpace(item)
+		desc := false
+		if strings.HasPrefix(item, "-") {
+			desc = true
+			item = item[1:]
+		} else if strings.HasPrefix(item, "+") {
+			item = item[1:]
+		}
+		if !isAllowedField(item, allowed) {
+			return nil, errors.New("cannot sort by " + item)
+		}
+		if used[item] {
+			return nil, errors.New("cannot sort by " + item + " twice")
+		}
+		used[item] = true
+		keys = append(keys, repositories.SortKey{Field: item, Desc: desc})
+	}
+	return keys, nil
+}
+
+func isAllowedField(field string, allowed []string) bool {
+	for _, item := range allowed {
+		if item == field {
+			return true
+		}
+	}
+	return false
+}
@@ -2,34 +2,39 @@ package controllers
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
-	"os"
 	"strings"
-	"time"
 
-	driver "github.com/arangodb/go-driver"
 	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
 	"github.com/joncalhoun/qson"
 
 	"groupware-gin/models"
+	"groupware-gin/repositories"
 )
 
+var errEmailUsed = errors.New("this email is already used")
+
 /*
  * GET /users
  *
  * Find some users
  */
 
+var userSortFields = []string{"name", "email", "created_at", "updated_at", "_key"}
+
 type FindUsersParams struct {
-	Search string `json:"search" valid:"optional"`
-	SortBy string `json:"sort_by" valid:"optional,in(name|email)"`
-	Limit  *int   `json:"limit" valid:"optional,range(5|100)"`
+	Search      string `json:"search" valid:"optional"`
+	Sort        string `json:"sort" valid:"optional"`                   // like -name,email
+	SortBy      string `json:"sort_by" valid:"optional,in(name|email)"` // deprecated, use sort
+	Limit       *int   `json:"limit" valid:"optional,range(5|100)"`
+	Offset      *int   `json:"offset" valid:"optional,range(0|1000000)"`
+	Cursor      string `json:"cursor" valid:"optional"`
+	WithTrashed bool   `json:"with_trashed" valid:"optional"`
+	OnlyTrashed bool   `json:"only_trashed" valid:"optional"`
+
+	Filter map[string]interface{} `json:"filter" valid:"-"` // like filter[name][contains]=foo
 }
 
 func (s *Server) FindUsers(c *gin.Context) {
@@ -40,58 +45,54 @@ func (s *Server) FindUsers(c *gin.Context) {
 	if c.Request.URL.RawQuery != "" { // hack: qson fails on empty string
 		err := qson.Unmarshal(&params, c.Request.URL.RawQuery)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, err)
+			abortWithError(c, http.StatusBadRequest, err)
 			return
 		}
 		params.Search = strings.TrimSpace(params.Search)
-		result, err := govalidator.ValidateStruct(params)
+		err = validate(params)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, err)
+			abortWithError(c, http.StatusBadRequest, err)
 			return
 		}
-		if !result {
-			c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+		if params.WithTrashed && params.OnlyTrashed {
+			abortWithError(c, http.StatusBadRequest, errors.New("with_trashed and only_trashed cannot be used together"))
 			return
 		}
 	}
-
-	// perform DB query
-	query := make([]string, 0)
-	query = append(query, "FOR x IN users")
-	bindVars := gin.H{}
-	if params.Search != "" {
-		query = append(query, "FILTER CONTAINS(x.name, @search) || CONTAINS(x.email, @search)")
-		bindVars["search"] = params.Search
+	offset, limit, err := pageWindow(params.Cursor, params.Offset, params.Limit)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
 	}
-	if params.SortBy != "" {
-		query = append(query, "SORT x."+params.SortBy+" ASC")
+	if params.Sort == "" {
+		params.Sort = params.SortBy
 	}
-	if params.Limit != nil {
-		query = append(query, "LIMIT 0, @limit")
-		bindVars["limit"] = params.Limit
+	sort, err := parseSort(params.Sort, userSortFields)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
+		return
 	}
-	query = append(query, "RETURN x")
-	cursor, err := s.DB.Query(ctx, strings.Join(query, " "), bindVars)
+	filter, err := parseFilter(params.Filter, userFilterFields)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
-	defer cursor.Close()
 
 	// make a result
-	users := []models.User{}
-	var doc models.User
-	for {
-		_, err := cursor.ReadDocument(ctx, &doc)
-		if driver.IsNoMoreDocuments(err) {
-			break
-		} else if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
-			return
-		}
-		users = append(users, doc)
+	users, total, err := s.Users.List(ctx, repositories.ListOptions{
+		Search:      params.Search,
+		Filter:      filter,
+		Sort:        sort,
+		Offset:      offset,
+		Limit:       limit,
+		WithTrashed: params.WithTrashed,
+		OnlyTrashed: params.OnlyTrashed,
+	})
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
 	}
-	c.JSON(http.StatusOK, users)
+	jsonWithETag(c, newPage(c, users, total, offset, limit))
 }
 
 /*
@@ -100,31 +101,38 @@ func (s *Server) FindUsers(c *gin.Context) {
  * Show a user
  */
 
+type ShowUserParams struct {
+	WithTrashed bool `json:"with_trashed" valid:"optional"`
+}
+
 func (s *Server) ShowUser(c *gin.Context) {
 	ctx := context.Background()
-	users, err := s.DB.Collection(ctx, "users")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
-		return
+
+	// validate URL query
+	var params ShowUserParams
+	if c.Request.URL.RawQuery != "" { // hack: qson fails on empty string
+		err := qson.Unmarshal(&params, c.Request.URL.RawQuery)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, err)
+			return
+		}
 	}
 
-	// validate params
-	key := c.Param("key")
-	found, err := users.DocumentExists(ctx, key)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	// make a result
+	doc, err := s.Users.Get(ctx, c.Param("key"))
+	if err == repositories.ErrNotFound {
+		abortWithError(c, http.StatusNotFound, errors.New("this user does not exist"))
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
-	if !found {
-		c.JSON(http.StatusNotFound, errors.New("this user does not exist"))
+	if doc.DeletedAt != nil && !params.WithTrashed {
+		abortWithError(c, http.StatusGone, errors.New("this user is trashed"))
 		return
 	}
-
-	// make a result
-	var doc models.User
-	_, err = users.ReadDocument(ctx, key, &doc)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	if notModified(c, doc.Rev, doc.UpdatedAt) {
+		c.Status(http.StatusNotModified)
 		return
 	}
 	c.JSON(http.StatusOK, doc)
@@ -147,80 +155,70 @@ func (s *Server) StoreUser(c *gin.Context) {
 	ctx := context.Background()
 
 	// validate payload
-	params := StoreUserParams{
-		Name:                 govalidator.Trim(c.Request.FormValue("name"), ""), // default trim removes space
-		Email:                c.Request.FormValue("email"),
-		Password:             c.Request.FormValue("password"),
-		PasswordConfirmation: c.Request.FormValue("password_confirmation"),
+	err := limitBody(c)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	var params StoreUserParams
+	err = bindBody(c, &params, "avatar")
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
+		return
 	}
-	res, err := govalidator.ValidateStruct(params)
+	params.Name = govalidator.Trim(params.Name, "") // default trim removes space
+	err = validate(params)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
-	if !res {
-		c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+	if params.Password != params.PasswordConfirmation {
+		abortWithError(c, http.StatusBadRequest, fieldInvalid("password_confirmation", "confirmed"))
 		return
 	}
-	if params.Password != c.Request.FormValue("password_confirmation") {
-		c.JSON(http.StatusBadRequest, errors.New("password not matched"))
+	image, err := readAvatar(c)
+	if err != nil {
+		abortWithError(c, avatarStatus(err), err)
 		return
 	}
 
 	// create a document
-	found, err := s.HasCollection("users")
+	hash, err := s.Hasher.Hash(params.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	doc, err := s.Users.Create(ctx, models.User{
+		Name:  params.Name,
+		Email: params.Email,
+		Role:  models.RoleMember,
+	}, hash)
+	if err == repositories.ErrConflict {
+		abortWithError(c, http.StatusConflict, errEmailUsed)
+		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
-	var users driver.Collection
-	if found {
-		col, err := s.DB.Collection(ctx, "users")
+
+	// store the uploaded avatar, that is optional
+	if image != nil {
+		avatar, err := s.storeAvatar(ctx, "users/"+doc.Key, image)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+			abortWithError(c, http.StatusInternalServerError, err)
 			return
 		}
-		users = col
-	} else {
-		options := &driver.CreateCollectionOptions{
-			Type: driver.CollectionTypeDocument,
-		}
-		col, err := s.DB.CreateCollection(ctx, "users", options)
+		doc, err = s.Users.Update(ctx, doc.Key, doc.Rev, repositories.UserPatch{
+			Avatar:     &avatar.Key,
+			Thumbnails: avatar.Thumbnails,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+			s.deleteAvatar(ctx, avatar.Key, avatar.Thumbnails) // not used
+			abortWithError(c, http.StatusInternalServerError, err)
 			return
 		}
-		users = col
-	}
-	hasher := md5.New()
-	now := time.Now().UTC()
-	meta, err := users.CreateDocument(ctx, gin.H{
-		"name":       params.Name,
-		"email":      params.Email,
-		"password":   hex.EncodeToString(hasher.Sum([]byte(params.Password))),
-		"created_at": now,
-		"updated_at": now,
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
-		return
-	}
-
-	// accept the uploaded file
-	fileName, err := AcceptFile(c, "avatar", "storage/users/"+meta.Key)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
-		return
-	}
-	var doc models.User
-	otherCtx := driver.WithReturnNew(ctx, &doc)
-	_, err = users.UpdateDocument(otherCtx, meta.Key, gin.H{
-		"avatar": "users/" + meta.Key + "/" + fileName,
-	})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
-		return
 	}
+	setETag(c, doc.Rev)
 	c.JSON(http.StatusOK, doc)
 }
 
@@ -233,18 +231,16 @@ func (s *Server) StoreUser(c *gin.Context) {
 func (s *Server) validateUserParams(c *gin.Context) (string, error) {
 	ctx := context.Background()
 	key := c.Param("key")
-	users, err := s.DB.Collection(ctx, "users")
-	if err != nil {
-		return "", err
-	}
-	found, err := users.DocumentExists(ctx, key)
-	if err != nil {
-		return key, err
-	}
-	if !found {
-		return key, errors.New("does not exist")
+	_, err := s.Users.Get(ctx, key)
+	return key, err // ErrNotFound for a missing user
+}
+
+// a missing document of the URL is 404, and others are the errors of the storage
+func paramsStatus(err error) int {
+	if err == repositories.ErrNotFound {
+		return http.StatusNotFound
 	}
-	return key, nil
+	return http.StatusInternalServerError
 }
 
 type UpdateUserParams struct {
@@ -252,6 +248,7 @@ type UpdateUserParams struct {
 	Email                string `json:"email,omitempty" valid:"optional,email"`
 	Password             string `json:"password,omitempty" valid:"optional,length(6|64),update_confirmed"`
 	PasswordConfirmation string `json:"password_confirmation,omitempty" valid:"optional"`
+	Role                 string `json:"role,omitempty" valid:"optional,in(admin|member)"`
 }
 
 func (s *Server) UpdateUser(c *gin.Context) {
@@ -260,80 +257,121 @@ func (s *Server) UpdateUser(c *gin.Context) {
 	// validate params
 	key, err := s.validateUserParams(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, paramsStatus(err), err)
 		return
 	}
 
-	// validate payload
-	var params UpdateUserParams
-	name := c.Request.FormValue("name")
-	if name != "" {
-		params.Name = govalidator.Trim(name, "") // default trim removes space
-	}
-	email := c.Request.FormValue("email")
-	if email != "" {
-		params.Email = email
+	// check permission
+	allowed, err := s.canManageUser(c, key)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
 	}
-	password := c.Request.FormValue("password")
-	if password != "" {
-		params.Password = password
+	if !allowed {
+		abortWithError(c, http.StatusForbidden, errPermissionDenied)
+		return
 	}
-	passwordConfirmation := c.Request.FormValue("password_confirmation")
-	if passwordConfirmation != "" {
-		params.PasswordConfirmation = passwordConfirmation
+
+	// the revision that the client has edited
+	rev, err := s.ifMatch(c)
+	if err != nil {
+		abortWithError(c, preconditionStatus(err), err)
+		return
 	}
-	result, err := govalidator.ValidateStruct(params)
+
+	// validate payload
+	err = limitBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
-	if !result {
-		c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+	var params UpdateUserParams
+	err = bindBody(c, &params, "avatar")
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
 		return
 	}
-
-	// accept the uploaded file
-	fileName, err := AcceptFile(c, "avatar", "storage/users/"+key)
+	if params.Name != "" {
+		params.Name = govalidator.Trim(params.Name, "") // default trim removes space
+	}
+	err = validate(params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
+	if params.Role != "" {
+		// only system admins can change the role
+		admin, err := s.isSystemAdmin(ctx, c.GetString("user_key"))
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if !admin {
+			abortWithError(c, http.StatusForbidden, errPermissionDenied)
+			return
+		}
+	}
 
-	// update a document
-	users, err := s.DB.Collection(ctx, "users")
+	// accept the uploaded avatar
+	image, err := readAvatar(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		abortWithError(c, avatarStatus(err), err)
 		return
 	}
-	data := gin.H{
-		"updated_at": time.Now().UTC(),
-	}
+
+	// update a document
+	var patch repositories.UserPatch
 	if params.Name != "" {
-		data["name"] = params.Name
+		patch.Name = &params.Name
 	}
 	if params.Email != "" {
-		data["email"] = params.Email
+		patch.Email = &params.Email
+	}
+	if params.Role != "" {
+		patch.Role = &params.Role
 	}
 	if params.Password != "" {
-		hasher := md5.New()
-		data["password"] = hex.EncodeToString(hasher.Sum([]byte(params.Password)))
+		hash, err := s.Hasher.Hash(params.Password)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		patch.Password = &hash
 	}
-	var doc models.User
-	if fileName != "" {
-		_, err := users.ReadDocument(ctx, key, &doc)
+	var old, avatar *storedAvatar
+	if image != nil {
+		doc, err := s.Users.Get(ctx, key)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		old = &storedAvatar{Key: doc.Avatar, Thumbnails: doc.Thumbnails}
+		avatar, err = s.storeAvatar(ctx, "users/"+key, image)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+			abortWithError(c, http.StatusInternalServerError, err)
 			return
 		}
-		os.Remove("storage/" + doc.Avatar)
-		data["avatar"] = "users/" + key + "/" + fileName
+		patch.Avatar = &avatar.Key
+		patch.Thumbnails = avatar.Thumbnails
 	}
-	otherCtx := driver.WithReturnNew(ctx, &doc)
-	_, err = users.UpdateDocument(otherCtx, key, data)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+	doc, err := s.Users.Update(ctx, key, rev, patch)
+	if err != nil && avatar != nil {
+		s.deleteAvatar(ctx, avatar.Key, avatar.Thumbnails) // not used
+	}
+	if err == repositories.ErrConflict {
+		abortWithError(c, http.StatusConflict, errEmailUsed)
+		return
+	} else if err == repositories.ErrPreconditionFailed {
+		abortWithError(c, http.StatusPreconditionFailed, err)
 		return
+	} else if err != nil {
+		abortWithError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if old != nil {
+		s.deleteAvatar(ctx, old.Key, old.Thumbnails) // replaced
 	}
+	setETag(c, doc.Rev)
 	c.JSON(http.StatusOK, doc)
 }
 
@@ -344,7 +382,8 @@ func (s *Server) UpdateUser(c *gin.Context) {
  */
 
 type DeleteUserParams struct {
-	Mode string `json:"mode" valid:"required,in(erase|trash|restore)"`
+	Mode    string `json:"mode" valid:"required,in(erase|trash|restore)"`
+	Cascade string `json:"cascade" valid:"optional,in(block|delete|trash)"` // only for erase, ERASE_CASCADE by default
 }
 
 func (s *Server) DeleteUser(c *gin.Context) {
@@ -353,68 +392,104 @@ func (s *Server) DeleteUser(c *gin.Context) {
 	// validate params
 	key, err := s.validateUserParams(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, paramsStatus(err), err)
 		return
 	}
 
 	// validate payload
-	dec := json.NewDecoder(c.Request.Body)
-	dec.DisallowUnknownFields()
 	var params DeleteUserParams
-	err = dec.Decode(&params)
-	if err != nil && err != io.EOF {
-		c.JSON(http.StatusBadRequest, err)
+	err = bindBody(c, &params)
+	if err != nil {
+		abortWithError(c, bindStatus(err), err)
+		return
+	}
+	err = validate(params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, err)
 		return
 	}
-	res, err := govalidator.ValidateStruct(params)
+
+	// check permission, users can trash only themselves
+	var allowed bool
+	if params.Mode == "trash" {
+		allowed, err = s.canManageUser(c, key)
+	} else {
+		allowed, err = s.isSystemAdmin(ctx, c.GetString("user_key"))
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, err)
+		abortWithError(c, http.StatusInternalServerError, err)
 		return
 	}
-	if !res {
-		c.JSON(http.StatusBadRequest, errors.New("validation failed"))
+	if !allowed {
+		abortWithError(c, http.StatusForbidden, errPermissionDenied)
 		return
 	}
 
-	// perform an action
-	users, err := s.DB.Collection(ctx, "users")
+	// the revision that the client has edited
+	rev, err := s.ifMatch(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		abortWithError(c, preconditionStatus(err), err)
 		return
 	}
+
+	// perform an action
 	if params.Mode == "erase" {
-		// delete a document permanently
-		os.RemoveAll("storage/users/" + key)
-		_, err = users.RemoveDocument(ctx, key)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+		// delete a document permanently, with its edges in the same transaction
+		cascade := params.Cascade
+		if cascade == "" {
+			cascade, err = DefaultCascade()
+			if err != nil {
+				abortWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		_, err = s.Users.Erase(ctx, key, rev, cascade)
+		if err == repositories.ErrHasEmployment {
+			abortWithError(c, http.StatusConflict, err)
+			return
+		} else if err == repositories.ErrPreconditionFailed {
+			abortWithError(c, http.StatusPreconditionFailed, err)
+			return
+		} else if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
+			return
+		}
+		if cascade == repositories.CascadeTrash {
+			// trashed instead of erased
+			doc, err := s.Users.Get(ctx, key)
+			if err != nil {
+				abortWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+			setETag(c, doc.Rev)
+			c.JSON(http.StatusOK, doc)
 			return
 		}
+		s.Storage.DeletePrefix(ctx, "users/"+key)
 		c.JSON(http.StatusNoContent, "")
 	} else if params.Mode == "trash" {
 		// delete a document temporarily
-		var doc models.User
-		otherCtx := driver.WithReturnNew(ctx, &doc)
-		_, err = users.UpdateDocument(otherCtx, key, gin.H{
-			"deleted_at": time.Now().UTC(),
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+		doc, err := s.Users.Trash(ctx, key, rev)
+		if err == repositories.ErrPreconditionFailed {
+			abortWithError(c, http.StatusPreconditionFailed, err)
+			return
+		} else if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
 			return
 		}
+		setETag(c, doc.Rev)
 		c.JSON(http.StatusOK, doc)
 	} else if params.Mode == "restore" {
 		// restore a document that was deleted temprarily
-		otherCtx := driver.WithKeepNull(ctx, false) // don't keep empty field
-		var doc models.User
-		anotherCtx := driver.WithReturnNew(otherCtx, &doc)
-		_, err = users.UpdateDocument(anotherCtx, key, gin.H{
-			"deleted_at": nil,
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, err)
+		doc, err := s.Users.Restore(ctx, key, rev)
+		if err == repositories.ErrPreconditionFailed {
+			abortWithError(c, http.StatusPreconditionFailed, err)
+			return
+		} else if err != nil {
+			abortWithError(c, http.StatusInternalServerError, err)
 			return
 		}
+		setETag(c, doc.Rev)
 		c.JSON(http.StatusOK, doc)
 	}
 }
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"groupware-gin/models"
+)
+
+type userPage struct {
+	Data  []models.User `json:"data"`
+	Total int64         `json:"total"`
+}
+
+func TestFindUsers(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.token(ts.insertUser("Alice", "alice@example.com", models.RoleMember))
+	ts.insertUser("Bob Smith", "bob@example.com", models.RoleMember)
+	ts.insertUser("Carol", "carol@example.org", models.RoleAdmin)
+	ts.trash("users", ts.insertUser("Trashed", "trashed@example.com", models.RoleMember))
+
+	find := func(query string) userPage {
+		t.Helper()
+		w := ts.request("GET", "/api/v1/users"+query, token, "")
+		expectStatus(t, w, http.StatusOK)
+		if strings.Contains(w.Body.String(), "password") {
+			t.Fatalf("the password is exposed: %s", w.Body.String())
+		}
+		var page userPage
+		decodeBody(t, w, &page)
+		return page
+	}
+
+	page := find("?sort=-name")
+	if page.Total != 3 || page.Data[0].Name != "Carol" {
+		t.Errorf("got %+v", page)
+	}
+	page = find("?search=SMITH")
+	if page.Total != 1 || page.Data[0].Name != "Bob Smith" {
+		t.Errorf("got %+v by search", page)
+	}
+	page = find("?filter[email][eq]=BOB@example.com")
+	if page.Total != 1 || page.Data[0].Name != "Bob Smith" {
+		t.Errorf("got %+v by email", page)
+	}
+	page = find("?filter[email][ends_with]=.org")
+	if page.Total != 1 || page.Data[0].Name != "Carol" {
+		t.Errorf("got %+v by domain", page)
+	}
+	page = find("?filter[role][eq]=admin")
+	if page.Total != 1 || page.Data[0].Name != "Carol" {
+		t.Errorf("got %+v by role", page)
+	}
+	page = find("?only_trashed=true")
+	if page.Total != 1 || page.Data[0].Name != "Trashed" {
+		t.Errorf("got %+v of trashed", page)
+	}
+
+	w := ts.request("GET", "/api/v1/users?filter[password][eq]=x", token, "")
+	expectError(t, w, http.StatusBadRequest, "invalid_filter")
+}
+
+func TestShowUser(t *testing.T) {
+	ts := newTestServer(t)
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	token := ts.token(key)
+	trashed := ts.insertUser("Trashed", "trashed@example.com", models.RoleMember)
+	ts.trash("users", trashed)
+
+	w := ts.request("GET", "/api/v1/users/"+key, token, "")
+	expectStatus(t, w, http.StatusOK)
+	var user models.User
+	decodeBody(t, w, &user)
+	if user.Key != key || user.Email != "alice@example.com" || strings.Contains(w.Body.String(), "password") {
+		t.Errorf("got %s", w.Body.String())
+	}
+	w = ts.request("GET", "/api/v1/users/"+key, token, "", "If-Modified-Since", w.Header().Get("Last-Modified"))
+	expectStatus(t, w, http.StatusNotModified)
+
+	w = ts.request("GET", "/api/v1/users/missing", token, "")
+	expectError(t, w, http.StatusNotFound, "not_found")
+	w = ts.request("GET", "/api/v1/users/"+trashed, token, "")
+	expectError(t, w, http.StatusGone, "gone")
+	w = ts.request("GET", "/api/v1/users/"+trashed+"?with_trashed=true", token, "")
+	expectStatus(t, w, http.StatusOK)
+}
+
+func TestStoreUser(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	member := ts.token(ts.insertUser("Alice", "alice@example.com", models.RoleMember))
+
+	w := ts.request("POST", "/api/v1/users", admin, `{"name":"Bob","email":"bob@example.com","password":"secret2","password_confirmation":"secret2"}`)
+	expectStatus(t, w, http.StatusOK)
+	var user models.User
+	decodeBody(t, w, &user)
+	if user.Key == "" || user.Role != models.RoleMember || strings.Contains(w.Body.String(), "password") {
+		t.Errorf("got %s", w.Body.String())
+	}
+	ts.login("bob@example.com", "secret2")
+
+	t.Run("stores the avatar", func(t *testing.T) {
+		w := ts.upload("POST", "/api/v1/users", admin, map[string]string{
+			"name":                  "Carol",
+			"email":                 "carol@example.com",
+			"password":              "secret3",
+			"password_confirmation": "secret3",
+		}, testImage(t, 300, 200))
+		expectStatus(t, w, http.StatusOK)
+		var user models.User
+		decodeBody(t, w, &user)
+		if user.Avatar == "" || len(user.Thumbnails) != 3 {
+			t.Fatalf("got %+v", user)
+		}
+		if _, err := ts.Storage.Stat(context.Background(), user.Avatar); err != nil {
+			t.Errorf("the avatar is not stored: %v", err)
+		}
+	})
+
+	t.Run("rejects the wrong requests", func(t *testing.T) {
+		w := ts.request("POST", "/api/v1/users", admin, `{"name":"Dave","email":"dave@example.com","password":"secret4","password_confirmation":"other"}`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+		w = ts.request("POST", "/api/v1/users", admin, `{"name":"Bob","email":"bob@example.com","password":"secret4","password_confirmation":"secret4"}`)
+		expectError(t, w, http.StatusConflict, "unique_violation")
+		w = ts.request("POST", "/api/v1/users", member, `{"name":"Dave","email":"dave@example.com","password":"secret4","password_confirmation":"secret4"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+		w = ts.request("POST", "/api/v1/users", admin, "name=Dave", "Content-Type", "text/plain")
+		expectStatus(t, w, http.StatusUnsupportedMediaType)
+	})
+}
+
+func TestUpdateUser(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	token := ts.token(key)
+	other := ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+
+	w := ts.request("PATCH", "/api/v1/users/"+key, token, `{"name":"Alice Liddell","password":"secret2","password_confirmation":"secret2"}`)
+	expectStatus(t, w, http.StatusOK)
+	var user models.User
+	decodeBody(t, w, &user)
+	if user.Name != "Alice Liddell" {
+		t.Errorf("got %+v", user)
+	}
+	ts.login("alice@example.com", "secret2")
+
+	t.Run("limits the permission", func(t *testing.T) {
+		w := ts.request("PATCH", "/api/v1/users/"+other, token, `{"name":"Bobby"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+		w = ts.request("PATCH", "/api/v1/users/"+key, token, `{"role":"admin"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+		w = ts.request("PATCH", "/api/v1/users/"+other, admin, `{"role":"admin"}`)
+		expectStatus(t, w, http.StatusOK)
+	})
+
+	t.Run("replaces the avatar", func(t *testing.T) {
+		w := ts.upload("PATCH", "/api/v1/users/"+key, token, nil, testImage(t, 100, 100))
+		expectStatus(t, w, http.StatusOK)
+		var first models.User
+		decodeBody(t, w, &first)
+		w = ts.upload("PATCH", "/api/v1/users/"+key, token, nil, testImage(t, 120, 100))
+		expectStatus(t, w, http.StatusOK)
+		var second models.User
+		decodeBody(t, w, &second)
+		if second.Avatar == "" || second.Avatar == first.Avatar {
+			t.Fatalf("got %q after %q", second.Avatar, first.Avatar)
+		}
+		if _, err := ts.Storage.Stat(context.Background(), first.Avatar); err == nil {
+			t.Errorf("the old avatar is kept")
+		}
+	})
+
+	t.Run("rejects the wrong changes", func(t *testing.T) {
+		w := ts.request("PATCH", "/api/v1/users/"+key, token, `{"email":"bob@example.com"}`)
+		expectError(t, w, http.StatusConflict, "unique_violation")
+		w = ts.request("PATCH", "/api/v1/users/"+key, token, `{"password":"secret3","password_confirmation":"other"}`)
+		expectError(t, w, http.StatusBadRequest, "validation_failed")
+		w = ts.request("PATCH", "/api/v1/users/"+key, token, `{"name":"Alice"}`, "If-Match", `"stale"`)
+		expectError(t, w, http.StatusPreconditionFailed, "precondition_failed")
+		w = ts.request("PATCH", "/api/v1/users/missing", admin, `{"name":"Nobody"}`)
+		expectError(t, w, http.StatusNotFound, "not_found")
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.token(ts.insertUser("Admin", "admin@example.com", models.RoleAdmin))
+	key := ts.insertUser("Alice", "alice@example.com", models.RoleMember)
+	token := ts.token(key)
+
+	t.Run("trashes oneself", func(t *testing.T) {
+		w := ts.request("DELETE", "/api/v1/users/"+key, token, `{"mode":"trash"}`)
+		expectStatus(t, w, http.StatusOK)
+		var user models.User
+		decodeBody(t, w, &user)
+		if user.DeletedAt == nil {
+			t.Errorf("got %+v", user)
+		}
+		// the trashed user is signed out
+		w = ts.request("DELETE", "/api/v1/users/"+key, token, `{"mode":"restore"}`)
+		expectError(t, w, http.StatusUnauthorized, "invalid_token")
+		w = ts.request("DELETE", "/api/v1/users/"+key, admin, `{"mode":"restore"}`)
+		expectStatus(t, w, http.StatusOK)
+	})
+
+	t.Run("erases with the files", func(t *testing.T) {
+		w := ts.upload("PATCH", "/api/v1/users/"+key, token, nil, testImage(t, 100, 100))
+		expectStatus(t, w, http.StatusOK)
+		var user models.User
+		decodeBody(t, w, &user)
+
+		w = ts.request("DELETE", "/api/v1/users/"+key, token, `{"mode":"erase"}`)
+		expectError(t, w, http.StatusForbidden, "permission_denied")
+		w = ts.request("DELETE", "/api/v1/users/"+key, admin, `{"mode":"erase"}`)
+		expectStatus(t, w, http.StatusNoContent)
+		if _, err := ts.store.Document("users", key); err == nil {
+			t.Errorf("the user is kept")
+		}
+		if _, err := ts.Storage.Stat(context.Background(), user.Avatar); err == nil {
+			t.Errorf("the avatar is kept")
+		}
+	})
+
+	t.Run("blocks the erase by employment", func(t *testing.T) {
+		other := ts.insertUser("Bob", "bob@example.com", models.RoleMember)
+		ts.insertWorkAt(other, ts.insertCompany("Acme"), models.RoleMember, "2020-01-01T00:00:00Z", "")
+		w := ts.request("DELETE", "/api/v1/users/"+other, admin, `{"mode":"erase","cascade":"block"}`)
+		expectError(t, w, http.StatusConflict, "has_employment")
+		w = ts.request("DELETE", "/api/v1/users/"+other, admin, `{"mode":"erase","cascade":"trash"}`)
+		expectStatus(t, w, http.StatusOK)
+		var user models.User
+		decodeBody(t, w, &user)
+		if user.DeletedAt == nil {
+			t.Errorf("got %+v", user)
+		}
+	})
+
+	w := ts.request("DELETE", "/api/v1/users/missing", admin, `{"mode":"trash"}`)
+	expectError(t, w, http.StatusNotFound, "not_found")
+}
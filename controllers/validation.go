@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+
+	"groupware-gin/locales"
+	"groupware-gin/models"
+)
+
+// the custom validators that share a message
+var ruleAliases = map[string]string{
+	"store_confirmed":  "confirmed",
+	"update_confirmed": "confirmed",
+}
+
+// FieldFailure is a rule that a field of the params breaks,
+// the message is made later in the language of the client
+type FieldFailure struct {
+	Field string   // the JSON name
+	Rule  string   // the name of the validator
+	Args  []string // like 6 and 64 of length(6|64)
+}
+
+// ValidationError has all failures of the params
+type ValidationError struct {
+	Failures []FieldFailure
+}
+
+func (e *ValidationError) Error() string {
+	items := []string{}
+	for _, failure := range e.Failures {
+		items = append(items, failure.Field+" "+failure.Rule)
+	}
+	return errValidationFailed.Error() + ": " + strings.Join(items, ", ")
+}
+
+// Is lets errors.Is find errValidationFailed
+func (e *ValidationError) Is(target error) bool {
+	return target == errValidationFailed
+}
+
+// Details localizes the failures
+func (e *ValidationError) Details(lang string) []models.FieldError {
+	details := []models.FieldError{}
+	for _, failure := range e.Failures {
+		args := []interface{}{}
+		if failure.Rule == "in" {
+			args = append(args, strings.Join(failure.Args, ", "))
+		} else {
+			for _, arg := range failure.Args {
+				args = append(args, arg)
+			}
+		}
+		details = append(details, models.FieldError{
+			Field:   failure.Field,
+			Rule:    failure.Rule,
+			Message: locales.Message(lang, failure.Rule, args...),
+		})
+	}
+	return details
+}
+
+// fieldInvalid reports one failure found outside the tags
+func fieldInvalid(field string, rule string, args ...string) error {
+	return &ValidationError{Failures: []FieldFailure{{Field: field, Rule: rule, Args: args}}}
+}
+
+// validate checks the params by their valid tags,
+// and reports every failing field
+func validate(params interface{}) error {
+	ok, err := govalidator.ValidateStruct(params)
+	if err == nil && ok {
+		return nil
+	}
+	result := &ValidationError{}
+	collectFailures(reflect.Indirect(reflect.ValueOf(params)).Type(), err, result)
+	if len(result.Failures) == 0 {
+		result.Failures = append(result.Failures, FieldFailure{Rule: "invalid"})
+	}
+	return result
+}
+
+func collectFailures(t reflect.Type, err error, result *ValidationError) {
+	switch e := err.(type) {
+	case govalidator.Errors:
+		for _, item := range e.Errors() {
+			collectFailures(t, item, result)
+		}
+	case govalidator.Error:
+		field, tag := structField(t, e.Name)
+		rule := e.Validator
+		if alias, found := ruleAliases[rule]; found {
+			rule = alias
+		}
+		result.Failures = append(result.Failures, FieldFailure{
+			Field: field,
+			Rule:  rule,
+			Args:  ruleArgs(tag, e.Validator),
+		})
+	}
+}
+
+// structField returns the JSON name and the valid tag of the field,
+// that govalidator names by its JSON name or else its Go name
+func structField(t reflect.Type, name string) (string, string) {
+	if t.Kind() != reflect.Struct {
+		return name, ""
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if jsonName == "" || jsonName == "-" {
+			jsonName = f.Name
+		}
+		if f.Name == name || jsonName == name {
+			return jsonName, f.Tag.Get("valid")
+		}
+	}
+	return name, ""
+}
+
+// ruleArgs finds the arguments of the rule in the tag like required,length(6|64)
+func ruleArgs(tag string, rule string) []string {
+	for _, option := range strings.Split(tag, ",") {
+		if !strings.HasPrefix(option, rule+"(") || !strings.HasSuffix(option, ")") {
+			continue
+		}
+		return strings.Split(option[len(rule)+1:len(option)-1], "|")
+	}
+	return nil
+}
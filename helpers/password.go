@@ -0,0 +1,215 @@
+package helpers
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher hashes new passwords and tells whether a stored hash
+// was made with other settings than the current ones.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	NeedsRehash(hash string) bool
+}
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// NewPasswordHasher builds the hasher selected by PASSWORD_HASHER (bcrypt or argon2id)
+func NewPasswordHasher() (PasswordHasher, error) {
+	switch os.Getenv("PASSWORD_HASHER") {
+	case "", "bcrypt":
+		cost, err := EnvInt("BCRYPT_COST", bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return &BcryptHasher{Cost: cost}, nil
+	case "argon2id":
+		time, err := EnvInt("ARGON2_TIME", 1)
+		if err != nil {
+			return nil, err
+		}
+		memory, err := EnvInt("ARGON2_MEMORY", 64*1024)
+		if err != nil {
+			return nil, err
+		}
+		threads, err := EnvInt("ARGON2_THREADS", 2)
+		if err != nil {
+			return nil, err
+		}
+		if time < 1 || memory < 8 || threads < 1 || threads > 255 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+		return &Argon2idHasher{
+			Time:    uint32(time),
+			Memory:  uint32(memory),
+			Threads: uint8(threads),
+			SaltLen: 16,
+			KeyLen:  32,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported PASSWORD_HASHER %q", os.Getenv("PASSWORD_HASHER"))
+	}
+}
+
+// VerifyPassword checks the password against a hash in any supported format,
+// including the legacy md5 one. When the password matches but the hash is not
+// the one that the given hasher would produce now, rehash is true.
+func VerifyPassword(hasher PasswordHasher, hash string, password string) (ok bool, rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		ok = true
+	case strings.HasPrefix(hash, "$argon2id$"):
+		ok, err = verifyArgon2id(hash, password)
+		if err != nil {
+			return false, false, err
+		}
+	case isLegacyHash(hash):
+		ok = subtle.ConstantTimeCompare([]byte(legacyHash(password)), []byte(hash)) == 1
+	default:
+		return false, false, ErrUnknownHashFormat
+	}
+	return ok, ok && hasher.NeedsRehash(hash), nil
+}
+
+/*
+ * bcrypt
+ */
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true // not a bcrypt hash
+	}
+	return cost != h.Cost
+}
+
+/*
+ * argon2id
+ */
+
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // in KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true // not an argon2id hash
+	}
+	return params.Time != h.Time || params.Memory != h.Memory || params.Threads != h.Threads ||
+		uint32(len(salt)) != h.SaltLen || uint32(len(key)) != h.KeyLen
+}
+
+func verifyArgon2id(hash string, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+// decode the PHC string like $argon2id$v=19$m=65536,t=1,p=2$<salt>$<key>
+func decodeArgon2id(hash string) (*Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+	params := &Argon2idHasher{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+	return params, salt, key, nil
+}
+
+/*
+ * legacy md5
+ *
+ * The old code stored hex(md5.New().Sum(password)), which is the password
+ * itself followed by the md5 digest of an empty input.
+ */
+
+var emptyMD5 = hex.EncodeToString(md5.New().Sum(nil))
+
+func legacyHash(password string) string {
+	hasher := md5.New()
+	return hex.EncodeToString(hasher.Sum([]byte(password)))
+}
+
+func isLegacyHash(hash string) bool {
+	if !strings.HasSuffix(hash, emptyMD5) || len(hash)%2 != 0 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
@@ -0,0 +1,138 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+)
+
+// small parameters keep the tests fast
+func testArgon2id() *Argon2idHasher {
+	return &Argon2idHasher{Time: 1, Memory: 8, Threads: 1, SaltLen: 16, KeyLen: 32}
+}
+
+func mustHash(t *testing.T, hasher PasswordHasher, password string) string {
+	t.Helper()
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestVerifyPassword(t *testing.T) {
+	bcrypt := &BcryptHasher{Cost: 4}
+	argon2id := testArgon2id()
+	bcryptHash := mustHash(t, bcrypt, "secret")
+	argon2idHash := mustHash(t, argon2id, "secret")
+
+	for _, test := range []struct {
+		name     string
+		hasher   PasswordHasher
+		hash     string
+		password string
+		ok       bool
+		rehash   bool
+		err      error
+	}{
+		{"bcrypt", bcrypt, bcryptHash, "secret", true, false, nil},
+		{"bcrypt with a wrong password", bcrypt, bcryptHash, "wrong", false, false, nil},
+		{"argon2id", argon2id, argon2idHash, "secret", true, false, nil},
+		{"argon2id with a wrong password", argon2id, argon2idHash, "wrong", false, false, nil},
+		{"bcrypt to argon2id", argon2id, bcryptHash, "secret", true, true, nil},
+		{"argon2id to bcrypt", bcrypt, argon2idHash, "secret", true, true, nil},
+		{"legacy md5", bcrypt, legacyHash("secret"), "secret", true, true, nil},
+		{"legacy md5 with a wrong password", bcrypt, legacyHash("secret"), "wrong", false, false, nil},
+		{"unknown format", bcrypt, "plain", "plain", false, false, ErrUnknownHashFormat},
+		{"empty hash", bcrypt, "", "", false, false, ErrUnknownHashFormat},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ok, rehash, err := VerifyPassword(test.hasher, test.hash, test.password)
+			if ok != test.ok || rehash != test.rehash || err != test.err {
+				t.Errorf("got %v, %v, %v, want %v, %v, %v", ok, rehash, err, test.ok, test.rehash, test.err)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash := mustHash(t, &BcryptHasher{Cost: 4}, "secret")
+	argon2idHash := mustHash(t, testArgon2id(), "secret")
+	changed := func(change func(h *Argon2idHasher)) *Argon2idHasher {
+		h := testArgon2id()
+		change(h)
+		return h
+	}
+
+	for _, test := range []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		want   bool
+	}{
+		{"the same bcrypt cost", &BcryptHasher{Cost: 4}, bcryptHash, false},
+		{"another bcrypt cost", &BcryptHasher{Cost: 5}, bcryptHash, true},
+		{"argon2id for bcrypt", &BcryptHasher{Cost: 4}, argon2idHash, true},
+		{"the same argon2id params", testArgon2id(), argon2idHash, false},
+		{"another argon2id time", changed(func(h *Argon2idHasher) { h.Time = 2 }), argon2idHash, true},
+		{"another argon2id memory", changed(func(h *Argon2idHasher) { h.Memory = 16 }), argon2idHash, true},
+		{"another argon2id threads", changed(func(h *Argon2idHasher) { h.Threads = 2 }), argon2idHash, true},
+		{"another argon2id salt length", changed(func(h *Argon2idHasher) { h.SaltLen = 8 }), argon2idHash, true},
+		{"another argon2id key length", changed(func(h *Argon2idHasher) { h.KeyLen = 16 }), argon2idHash, true},
+		{"bcrypt for argon2id", testArgon2id(), bcryptHash, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.hasher.NeedsRehash(test.hash); got != test.want {
+				t.Errorf("got %v", got)
+			}
+		})
+	}
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	hasher := &Argon2idHasher{Time: 2, Memory: 16, Threads: 3, SaltLen: 8, KeyLen: 24}
+	hash := mustHash(t, hasher, "secret")
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=16,t=2,p=3$") {
+		t.Errorf("got %q", hash)
+	}
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *params != *hasher || len(salt) != 8 || len(key) != 24 {
+		t.Errorf("got %+v with %d bytes of salt and %d bytes of key", params, len(salt), len(key))
+	}
+
+	for _, hash := range []string{
+		"",
+		"$argon2i$v=19$m=16,t=2,p=3$c2FsdA$a2V5",
+		"$argon2id$v=19$m=16,t=2,p=3$c2FsdA",
+		"$argon2id$v=16$m=16,t=2,p=3$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=2,p=3$c2FsdA$a2V5",
+		"$argon2id$v=19$m=16,t=2,p=3$!!!$a2V5",
+		"$argon2id$v=19$m=16,t=2,p=3$c2FsdA$!!!",
+	} {
+		_, _, _, err := decodeArgon2id(hash)
+		if err == nil {
+			t.Errorf("%q is decoded", hash)
+		}
+	}
+}
+
+func TestIsLegacyHash(t *testing.T) {
+	for _, test := range []struct {
+		hash string
+		want bool
+	}{
+		{legacyHash("secret"), true},
+		{legacyHash(""), true},
+		{emptyMD5, true},
+		{"736563726574", false},             // hex without the digest
+		{"7" + legacyHash("secret"), false}, // odd length
+		{"zz" + emptyMD5, false},            // not hex
+		{mustHash(t, &BcryptHasher{Cost: 4}, "secret"), false},
+	} {
+		if got := isLegacyHash(test.hash); got != test.want {
+			t.Errorf("got %v for %q", got, test.hash)
+		}
+	}
+}
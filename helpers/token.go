@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenSigner issues short-lived access tokens as signed JWT,
+// and opaque refresh tokens whose hash is kept in database.
+type TokenSigner struct {
+	Secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+var ErrInvalidToken = errors.New("invalid token")
+
+func NewTokenSigner() (*TokenSigner, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errors.New("JWT_SECRET is required")
+	}
+	accessTTL, err := EnvDuration("JWT_ACCESS_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	refreshTTL, err := EnvDuration("JWT_REFRESH_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSigner{
+		Secret:     []byte(secret),
+		AccessTTL:  accessTTL,
+		RefreshTTL: refreshTTL,
+	}, nil
+}
+
+func (t *TokenSigner) SignAccessToken(subject string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(t.AccessTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		Subject:   subject,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	signed, err := token.SignedString(t.Secret)
+	if err != nil {
+		return "", expiresAt, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken returns the subject of a valid access token
+func (t *TokenSigner) ParseAccessToken(signed string) (string, error) {
+	var claims jwt.StandardClaims
+	token, err := jwt.ParseWithClaims(signed, &claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrInvalidToken // reject "none" and asymmetric algorithms
+		}
+		return t.Secret, nil
+	})
+	if err != nil || !token.Valid {
+		return "", ErrInvalidToken
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) || claims.Subject == "" {
+		return "", ErrInvalidToken
+	}
+	return claims.Subject, nil
+}
+
+// NewRefreshToken makes a random token for the client,
+// and its hash that is safe to store
+func (t *TokenSigner) NewRefreshToken() (string, string, time.Time, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expiresAt := time.Now().Add(t.RefreshTTL).UTC().Truncate(time.Second) // readable by the TTL index
+	return token, HashRefreshToken(token), expiresAt, nil
+}
+
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
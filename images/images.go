@@ -0,0 +1,128 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // registers the decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the decoder
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("the image must be JPEG, PNG, WebP or GIF")
+	ErrTooManyPixels     = errors.New("the image has too many pixels")
+)
+
+// the formats detected from the content, never from the file name
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+}
+
+// Encoded is a file ready to store
+type Encoded struct {
+	Data        []byte
+	ContentType string
+	Ext         string // like .jpg
+}
+
+// Result has the cleaned original and the square thumbnails by their sizes
+type Result struct {
+	Original   Encoded
+	Thumbnails map[int]Encoded
+}
+
+// Sniff returns the content type of a supported image
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, found := extensions[contentType]; !found {
+		return "", ErrUnsupportedFormat
+	}
+	return contentType, nil
+}
+
+// Process checks the uploaded image and makes the files to store.
+// JPEG is turned upright by its EXIF orientation and encoded again without the EXIF.
+// PNG and WebP are encoded as PNG, because there is no WebP encoder,
+// and it drops their metadata chunks too.
+// GIF is kept as it is for the animation, because it has no EXIF.
+func Process(data []byte, sizes []int, maxPixels int) (*Result, error) {
+	contentType, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the dimensions before decoding the pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > int64(maxPixels) {
+		return nil, ErrTooManyPixels
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if contentType == "image/jpeg" {
+		img = orient(img, exifOrientation(data))
+	}
+
+	result := &Result{Thumbnails: map[int]Encoded{}}
+	switch contentType {
+	case "image/gif":
+		result.Original = Encoded{Data: data, ContentType: contentType, Ext: extensions[contentType]}
+	case "image/jpeg":
+		result.Original, err = encodeJPEG(img)
+	default:
+		result.Original, err = encodePNG(img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, size := range sizes {
+		thumbnail := square(img, size)
+		if contentType == "image/jpeg" {
+			result.Thumbnails[size], err = encodeJPEG(thumbnail)
+		} else {
+			result.Thumbnails[size], err = encodePNG(thumbnail) // keep the transparency
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// square crops the center of the image and scales it to the size
+func square(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, image.Rect(x, y, x+side, y+side), draw.Src, nil)
+	return dst
+}
+
+func encodeJPEG(img image.Image) (Encoded, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	return Encoded{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: ".jpg"}, err
+}
+
+func encodePNG(img image.Image) (Encoded, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return Encoded{Data: buf.Bytes(), ContentType: "image/png", Ext: ".png"}, err
+}
@@ -0,0 +1,20 @@
+package locales
+
+var en = map[string]string{
+	"validation_failed": "validation failed",
+	"invalid":           "is invalid",
+
+	// the rules of govalidator
+	"required":  "is required",
+	"notnull":   "must not be empty",
+	"email":     "must be a valid email address",
+	"length":    "must be between %s and %s characters",
+	"range":     "must be between %s and %s",
+	"in":        "must be one of %s",
+	"rfc3339":   "must be a date and time like 2006-01-02T15:04:05Z",
+	"confirmed": "does not match the confirmation",
+	"unknown":   "is not allowed",
+	"single":    "must be given once",
+	"image":     "must be a JPEG, PNG, WebP or GIF image",
+	"pixels":    "must have at most %s megapixels",
+}
@@ -0,0 +1,20 @@
+package locales
+
+var es = map[string]string{
+	"validation_failed": "la validación falló",
+	"invalid":           "no es válido",
+
+	// the rules of govalidator
+	"required":  "es obligatorio",
+	"notnull":   "no puede estar vacío",
+	"email":     "debe ser una dirección de correo electrónico válida",
+	"length":    "debe tener entre %s y %s caracteres",
+	"range":     "debe estar entre %s y %s",
+	"in":        "debe ser uno de %s",
+	"rfc3339":   "debe ser una fecha y hora como 2006-01-02T15:04:05Z",
+	"confirmed": "no coincide con la confirmación",
+	"unknown":   "no está permitido",
+	"single":    "debe indicarse una sola vez",
+	"image":     "debe ser una imagen JPEG, PNG, WebP o GIF",
+	"pixels":    "debe tener como máximo %s megapíxeles",
+}
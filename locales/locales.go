@@ -0,0 +1,45 @@
+package locales
+
+import (
+	"fmt"
+
+	"golang.org/x/text/language"
+)
+
+// Default is used when Accept-Language matches no catalog
+const Default = "en"
+
+// the messages are formatted by fmt.Sprintf with the arguments of the rule
+var catalogs = map[string]map[string]string{
+	"en": en,
+	"es": es,
+}
+
+// the first tag is the default of the matcher
+var matcher = language.NewMatcher([]language.Tag{
+	language.English,
+	language.Spanish,
+})
+
+// Negotiate picks the language of the catalog from Accept-Language
+func Negotiate(acceptLanguage string) string {
+	tag, _ := language.MatchStrings(matcher, acceptLanguage)
+	base, _ := tag.Base()
+	if _, found := catalogs[base.String()]; !found {
+		return Default
+	}
+	return base.String()
+}
+
+// Message formats the message of the key in the language,
+// falling back to the default language and then to the key itself
+func Message(lang string, key string, args ...interface{}) string {
+	format, found := catalogs[lang][key]
+	if !found {
+		format, found = catalogs[Default][key]
+	}
+	if !found {
+		return key
+	}
+	return fmt.Sprintf(format, args...)
+}
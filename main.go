@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 
+	"groupware-gin/blobs"
 	"groupware-gin/controllers"
+	"groupware-gin/helpers"
+	"groupware-gin/migrations"
 	"groupware-gin/seeds"
 )
 
@@ -15,6 +20,8 @@ var server = controllers.Server{}
 
 func main() {
 	fmt.Println("Use --seed flag to install fake database and download fake images")
+	fmt.Println("Use --purge-trash flag to erase the trashed documents older than TRASH_RETENTION")
+	fmt.Println("Use migrate up|down|status command to apply, roll back or list the schema migrations")
 	fmt.Println()
 
 	err := godotenv.Load()
@@ -22,6 +29,11 @@ func main() {
 		log.Fatalf("Error getting env %v\n", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		os.Exit(0)
+	}
+
 	for _, arg := range os.Args[1:] {
 		// fmt.Printf("Argument %d is %s\n", i, arg)
 		if arg == "--seed" {
@@ -29,8 +41,84 @@ func main() {
 			// seeds.InstallUsers()
 			os.Exit(1)
 		}
+		if arg == "--purge-trash" {
+			purgeTrash()
+			os.Exit(0)
+		}
 	}
 
-	server.Initialize()
+	err = server.Initialize()
+	if err != nil {
+		log.Fatalf("Error initializing server %v\n", err)
+	}
 	server.Router.Run("127.0.0.1:" + os.Getenv("PORT")) // add 127.0.0.1 to prevent Windows Defender Firewall from appearing on every launch
 }
+
+func purgeTrash() {
+	db, err := helpers.OpenDatabase()
+	if err != nil {
+		log.Fatalf("Error opening database %v\n", err)
+	}
+	retention, err := controllers.TrashRetention()
+	if err != nil {
+		log.Fatalf("Error getting env %v\n", err)
+	}
+	store, err := blobs.NewBlobStore()
+	if err != nil {
+		log.Fatalf("Error opening storage %v\n", err)
+	}
+	purger := controllers.Server{DB: db, Storage: store}
+	purger.SetUpRepositories()
+	_, err = purger.PurgeTrash(retention)
+	if err != nil {
+		log.Fatalf("Error purging trash %v\n", err)
+	}
+}
+
+func migrate(args []string) {
+	if len(args) != 1 {
+		log.Fatalln("Usage: migrate up|down|status")
+	}
+	db, err := helpers.OpenDatabase()
+	if err != nil {
+		log.Fatalf("Error opening database %v\n", err)
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		done, err := migrations.Up(ctx, db)
+		for _, migration := range done {
+			fmt.Printf("Applied %04d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Error migrating %v\n", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("Nothing to migrate")
+		}
+	case "down":
+		migration, err := migrations.Down(ctx, db)
+		if err != nil {
+			log.Fatalf("Error rolling back %v\n", err)
+		}
+		if migration == nil {
+			fmt.Println("Nothing to roll back")
+		} else {
+			fmt.Printf("Rolled back %04d %s\n", migration.Version, migration.Name)
+		}
+	case "status":
+		list, err := migrations.List(ctx, db)
+		if err != nil {
+			log.Fatalf("Error listing migrations %v\n", err)
+		}
+		for _, status := range list {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d %-30s %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		log.Fatalf("Unknown migrate command %q, use up, down or status\n", args[0])
+	}
+}
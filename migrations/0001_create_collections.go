@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+var collections = []struct {
+	name           string
+	collectionType driver.CollectionType
+}{
+	{"users", driver.CollectionTypeDocument},
+	{"companies", driver.CollectionTypeDocument},
+	{"work_at", driver.CollectionTypeEdge},
+	{"refresh_tokens", driver.CollectionTypeDocument},
+}
+
+func createCollectionsUp(ctx context.Context, db driver.Database) error {
+	for _, item := range collections {
+		_, err := ensureCollection(ctx, db, item.name, &driver.CreateCollectionOptions{
+			Type: item.collectionType,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createCollectionsDown(ctx context.Context, db driver.Database) error {
+	for i := len(collections) - 1; i >= 0; i-- {
+		err := dropCollection(ctx, db, collections[i].name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
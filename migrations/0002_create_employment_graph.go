@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// users work at companies
+func createEmploymentGraphUp(ctx context.Context, db driver.Database) error {
+	found, err := db.GraphExists(ctx, "employment")
+	if err != nil || found {
+		return err
+	}
+	edgeDef := driver.EdgeDefinition{
+		Collection: "work_at",
+		From:       []string{"users"},
+		To:         []string{"companies"},
+	}
+	options := &driver.CreateGraphOptions{
+		EdgeDefinitions: []driver.EdgeDefinition{edgeDef},
+	}
+	_, err = db.CreateGraph(ctx, "employment", options)
+	return err
+}
+
+// the collections are kept, they belong to the first migration
+func createEmploymentGraphDown(ctx context.Context, db driver.Database) error {
+	graph, err := db.Graph(ctx, "employment")
+	if driver.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return graph.Remove(ctx)
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+
+	"groupware-gin/repositories"
+)
+
+// the view over users and companies, or update their links when the view exists already
+func createSearchViewUp(ctx context.Context, db driver.Database) error {
+	// lower case and no accent, without stemming so that prefixes still match
+	accent := false
+	stemming := false
+	_, _, err := db.EnsureAnalyzer(ctx, driver.ArangoSearchAnalyzerDefinition{
+		Name: repositories.SearchAnalyzer,
+		Type: driver.ArangoSearchAnalyzerTypeText,
+		Properties: driver.ArangoSearchAnalyzerProperties{
+			Locale:    "en.utf-8",
+			Case:      driver.ArangoSearchCaseLower,
+			Accent:    &accent,
+			Stemming:  &stemming,
+			Stopwords: []string{},
+		},
+		Features: []driver.ArangoSearchAnalyzerFeature{
+			driver.ArangoSearchAnalyzerFeatureFrequency, // required by BM25
+			driver.ArangoSearchAnalyzerFeatureNorm,
+			driver.ArangoSearchAnalyzerFeaturePosition,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	field := driver.ArangoSearchElementProperties{
+		Analyzers: []string{repositories.SearchAnalyzer},
+	}
+	properties := driver.ArangoSearchViewProperties{
+		Links: driver.ArangoSearchLinks{
+			"users": driver.ArangoSearchElementProperties{
+				Fields: driver.ArangoSearchFields{
+					"name":  field,
+					"email": field,
+				},
+			},
+			"companies": driver.ArangoSearchElementProperties{
+				Fields: driver.ArangoSearchFields{
+					"name": field,
+				},
+			},
+		},
+	}
+	found, err := db.ViewExists(ctx, repositories.SearchView)
+	if err != nil {
+		return err
+	}
+	if !found {
+		_, err = db.CreateArangoSearchView(ctx, repositories.SearchView, &properties)
+		return err
+	}
+	view, err := db.View(ctx, repositories.SearchView)
+	if err != nil {
+		return err
+	}
+	asView, err := view.ArangoSearchView()
+	if err != nil {
+		return err
+	}
+	return asView.SetProperties(ctx, properties)
+}
+
+func createSearchViewDown(ctx context.Context, db driver.Database) error {
+	view, err := db.View(ctx, repositories.SearchView)
+	if err == nil {
+		err = view.Remove(ctx)
+	}
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+	analyzer, err := db.Analyzer(ctx, repositories.SearchAnalyzer)
+	if driver.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return analyzer.Remove(ctx, false)
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// emails are stored in lower case, so the unique index ignores the case,
+// the company names are made unique regardless of the case later by 0006
+var indexes = []struct {
+	collection string
+	name       string
+	fields     []string
+	unique     bool
+	sparse     bool
+}{
+	{"users", "users_email", []string{"email"}, true, false},
+	{"users", "users_name", []string{"name"}, false, false},
+	{"users", "users_created_at", []string{"created_at"}, false, false},
+	{"users", "users_deleted_at", []string{"deleted_at"}, false, true},
+	{"companies", "companies_name", []string{"name"}, true, false},
+	{"companies", "companies_since", []string{"since"}, false, false},
+	{"companies", "companies_created_at", []string{"created_at"}, false, false},
+	{"companies", "companies_deleted_at", []string{"deleted_at"}, false, true},
+}
+
+func createIndexesUp(ctx context.Context, db driver.Database) error {
+	// the emails stored before must be lower case to be unique
+	cursor, err := db.Query(ctx, "FOR x IN users FILTER x.email != LOWER(x.email) UPDATE x WITH { email: LOWER(x.email) } IN users", nil)
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+
+	for _, item := range indexes {
+		col, err := db.Collection(ctx, item.collection)
+		if err != nil {
+			return err
+		}
+		_, _, err = col.EnsurePersistentIndex(ctx, item.fields, &driver.EnsurePersistentIndexOptions{
+			Name:   item.name,
+			Unique: item.unique,
+			Sparse: item.sparse,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func createIndexesDown(ctx context.Context, db driver.Database) error {
+	for _, item := range indexes {
+		col, err := db.Collection(ctx, item.collection)
+		if driver.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		index, err := col.Index(ctx, item.name)
+		if driver.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = index.Remove(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+const refreshTokensTTLIndex = "refresh_tokens_expires_at"
+
+// the server removes the refresh tokens when they expire, used or not.
+// new tokens expire at a whole second, and the ones stored with nanoseconds
+// are cut in the same way, so every value is a plain ISO 8601 date for the index.
+func expireRefreshTokensUp(ctx context.Context, db driver.Database) error {
+	query := "FOR x IN refresh_tokens FILTER IS_STRING(x.expires_at) && LENGTH(x.expires_at) > 20" +
+		" UPDATE x WITH { expires_at: CONCAT(LEFT(x.expires_at, 19), 'Z') } IN refresh_tokens"
+	cursor, err := db.Query(ctx, query, nil)
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+
+	col, err := db.Collection(ctx, "refresh_tokens")
+	if err != nil {
+		return err
+	}
+	_, _, err = col.EnsureTTLIndex(ctx, "expires_at", 0, &driver.EnsureTTLIndexOptions{
+		Name: refreshTokensTTLIndex,
+	})
+	return err
+}
+
+func expireRefreshTokensDown(ctx context.Context, db driver.Database) error {
+	col, err := db.Collection(ctx, "refresh_tokens")
+	if driver.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	index, err := col.Index(ctx, refreshTokensTTLIndex)
+	if driver.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return index.Remove(ctx)
+}
@@ -0,0 +1,80 @@
+package migrations
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+const (
+	companiesNameIndex      = "companies_name"
+	companiesNameLowerIndex = "companies_name_lower"
+)
+
+// the company names are unique regardless of the case, by the lower case copy
+// that the repository keeps beside the name. this fails when some names differ
+// only by the case already, so rename them first and run it again.
+func ignoreCaseOfCompanyNamesUp(ctx context.Context, db driver.Database) error {
+	cursor, err := db.Query(ctx, "FOR x IN companies FILTER x.name_lower != LOWER(x.name) UPDATE x WITH { name_lower: LOWER(x.name) } IN companies", nil)
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+
+	col, err := db.Collection(ctx, "companies")
+	if err != nil {
+		return err
+	}
+	_, _, err = col.EnsurePersistentIndex(ctx, []string{"name_lower"}, &driver.EnsurePersistentIndexOptions{
+		Name:   companiesNameLowerIndex,
+		Unique: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the name keeps the index for sorting, but not unique
+	return replaceNameIndex(ctx, col, false)
+}
+
+func ignoreCaseOfCompanyNamesDown(ctx context.Context, db driver.Database) error {
+	col, err := db.Collection(ctx, "companies")
+	if driver.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = replaceNameIndex(ctx, col, true)
+	if err != nil {
+		return err
+	}
+	index, err := col.Index(ctx, companiesNameLowerIndex)
+	if err == nil {
+		err = index.Remove(ctx)
+	}
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+	cursor, err := db.Query(ctx, "FOR x IN companies FILTER HAS(x, 'name_lower') UPDATE x WITH { name_lower: null } IN companies OPTIONS { keepNull: false }", nil)
+	if err != nil {
+		return err
+	}
+	cursor.Close()
+	return nil
+}
+
+// an index can not change its uniqueness, so it is made again with the same name
+func replaceNameIndex(ctx context.Context, col driver.Collection, unique bool) error {
+	index, err := col.Index(ctx, companiesNameIndex)
+	if err == nil {
+		err = index.Remove(ctx)
+	}
+	if err != nil && !driver.IsNotFound(err) {
+		return err
+	}
+	_, _, err = col.EnsurePersistentIndex(ctx, []string{"name"}, &driver.EnsurePersistentIndexOptions{
+		Name:   companiesNameIndex,
+		Unique: unique,
+	})
+	return err
+}
@@ -0,0 +1,210 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// the applied migrations are recorded in this system collection
+const collectionName = "_migrations"
+
+// Migration changes the schema, both functions must be idempotent
+// so a migration interrupted halfway can run again
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db driver.Database) error
+	Down    func(ctx context.Context, db driver.Database) error
+}
+
+// add a new migration at the end with the next version,
+// never change the applied ones
+var all = []Migration{
+	{1, "create collections", createCollectionsUp, createCollectionsDown},
+	{2, "create employment graph", createEmploymentGraphUp, createEmploymentGraphDown},
+	{3, "create search view", createSearchViewUp, createSearchViewDown},
+	{4, "create indexes", createIndexesUp, createIndexesDown},
+	{5, "expire refresh tokens", expireRefreshTokensUp, expireRefreshTokensDown},
+	{6, "ignore case of company names", ignoreCaseOfCompanyNamesUp, ignoreCaseOfCompanyNamesDown},
+}
+
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // nil if pending
+}
+
+type record struct {
+	Key       string    `json:"_key"`
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+func recordKey(version int) string {
+	return fmt.Sprintf("%04d", version)
+}
+
+// List returns all migrations in order with when they were applied
+func List(ctx context.Context, db driver.Database) ([]Status, error) {
+	applied, err := appliedRecords(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	result := []Status{}
+	for _, migration := range sorted() {
+		status := Status{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if r, found := applied[migration.Version]; found {
+			appliedAt := r.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Pending returns the migrations not applied yet
+func Pending(ctx context.Context, db driver.Database) ([]Migration, error) {
+	applied, err := appliedRecords(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	result := []Migration{}
+	for _, migration := range sorted() {
+		if _, found := applied[migration.Version]; !found {
+			result = append(result, migration)
+		}
+	}
+	return result, nil
+}
+
+// Up applies all pending migrations in order and returns them
+func Up(ctx context.Context, db driver.Database) ([]Migration, error) {
+	pending, err := Pending(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	col, err := ensureRecords(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for _, migration := range pending {
+		err = migration.Up(ctx, db)
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		_, err = col.CreateDocument(ctx, record{
+			Key:       recordKey(migration.Version),
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the latest applied migration and returns it,
+// or nil if nothing is applied
+func Down(ctx context.Context, db driver.Database) (*Migration, error) {
+	applied, err := appliedRecords(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	migrations := sorted()
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if _, found := applied[migration.Version]; !found {
+			continue
+		}
+		err = migration.Down(ctx, db)
+		if err != nil {
+			return nil, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		col, err := db.Collection(ctx, collectionName)
+		if err != nil {
+			return nil, err
+		}
+		_, err = col.RemoveDocument(ctx, recordKey(migration.Version))
+		if err != nil {
+			return nil, err
+		}
+		return &migration, nil
+	}
+	return nil, nil
+}
+
+func sorted() []Migration {
+	result := append([]Migration{}, all...)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+func appliedRecords(ctx context.Context, db driver.Database) (map[int]record, error) {
+	applied := map[int]record{}
+	found, err := db.CollectionExists(ctx, collectionName)
+	if err != nil || !found {
+		return applied, err
+	}
+	cursor, err := db.Query(ctx, "FOR x IN @@collection RETURN x", map[string]interface{}{
+		"@collection": collectionName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+	for {
+		var doc record
+		_, err := cursor.ReadDocument(ctx, &doc)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		applied[doc.Version] = doc
+	}
+	return applied, nil
+}
+
+func ensureRecords(ctx context.Context, db driver.Database) (driver.Collection, error) {
+	return ensureCollection(ctx, db, collectionName, &driver.CreateCollectionOptions{
+		Type:     driver.CollectionTypeDocument,
+		IsSystem: true, // required by the name starting with underscore
+	})
+}
+
+// ensureCollection opens the collection, creating it if missing
+func ensureCollection(ctx context.Context, db driver.Database, name string, options *driver.CreateCollectionOptions) (driver.Collection, error) {
+	found, err := db.CollectionExists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return db.Collection(ctx, name)
+	}
+	return db.CreateCollection(ctx, name, options)
+}
+
+// dropCollection removes the collection if it exists
+func dropCollection(ctx context.Context, db driver.Database, name string) error {
+	col, err := db.Collection(ctx, name)
+	if driver.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return col.Remove(ctx)
+}
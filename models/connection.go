@@ -0,0 +1,26 @@
+package models
+
+// a user who works at the same company
+
+type Colleague struct {
+	User    User    `json:"user"`
+	Company Company `json:"company"`
+	WorkAt  WorkAt  `json:"work_at"`
+}
+
+// two users linked by the company where both work
+
+type Link struct {
+	From    User    `json:"from"`
+	Company Company `json:"company"`
+	To      User    `json:"to"`
+}
+
+// a user reachable through the employment graph,
+// the degree is the number of links in the shortest path
+
+type Connection struct {
+	User   User   `json:"user"`
+	Degree int    `json:"degree"`
+	Path   []Link `json:"path"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// a page of the list result,
+// pass the next cursor to get the following page
+
+type Page struct {
+	Data       interface{} `json:"data"`
+	Total      int64       `json:"total"`
+	Offset     int         `json:"offset"`
+	Limit      int         `json:"limit"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// the refresh token itself is never stored, only its hash as the key.
+// all tokens rotated from the same login share a family,
+// so that the whole chain can be revoked when a used token is replayed.
+
+type RefreshToken struct {
+	Key        string    `json:"_key"`
+	UserKey    string    `json:"user_key"`
+	Family     string    `json:"family"`
+	ReplacedBy string    `json:"replaced_by,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
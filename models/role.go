@@ -0,0 +1,9 @@
+package models
+
+// a user has a system-wide role on its document,
+// and a role per company on each work_at edge
+
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
@@ -0,0 +1,10 @@
+package models
+
+// a user or company found by the search,
+// the higher score is the more relevant
+
+type SearchResult struct {
+	Type     string      `json:"type"` // user or company
+	Score    float64     `json:"score"`
+	Document interface{} `json:"document"`
+}
@@ -0,0 +1,8 @@
+package models
+
+import "time"
+
+type SignedURL struct {
+	URL       string    `json:"url"` // the path with the signature, relative to the API host
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -10,13 +10,15 @@ import (
 // this struct is used only for json output
 
 type User struct {
-	ID        driver.DocumentID `json:"_id,omitempty"`  // empty on create
-	Key       string            `json:"_key,omitempty"` // empty on create
-	Rev       string            `json:"_rev,omitempty"` // empty on create
-	Name      string            `json:"name"`
-	Email     string            `json:"email"`
-	Avatar    string            `json:"avatar"`
-	CreatedAt time.Time         `json:"created_at"`
-	UpdatedAt time.Time         `json:"updated_at"`
-	DeletedAt *time.Time        `json:"deleted_at,omitempty"`
+	ID         driver.DocumentID `json:"_id,omitempty"`  // empty on create
+	Key        string            `json:"_key,omitempty"` // empty on create
+	Rev        string            `json:"_rev,omitempty"` // empty on create
+	Name       string            `json:"name"`
+	Email      string            `json:"email"`
+	Avatar     string            `json:"avatar"`
+	Thumbnails map[string]string `json:"thumbnails,omitempty"` // the square thumbnails of the avatar by their sizes like "64"
+	Role       string            `json:"role"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	DeletedAt  *time.Time        `json:"deleted_at,omitempty"`
 }
@@ -1,10 +1,37 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// edge from users to companies in the employment graph.
+// the edge is kept after the employment ends to remember the history,
+// so a user can have several edges to the same company without overlap.
 
 type WorkAt struct {
-	From     string    `json:"_from"`
-	To       string    `json:"_to"`
-	Since    time.Time `json:"since"`
-	Position string    `json:"position"`
+	ID       driver.DocumentID `json:"_id,omitempty"`  // empty on create
+	Key      string            `json:"_key,omitempty"` // empty on create
+	Rev      string            `json:"_rev,omitempty"` // empty on create
+	From     string            `json:"_from"`
+	To       string            `json:"_to"`
+	Since    time.Time         `json:"since"`
+	Until    *time.Time        `json:"until,omitempty"` // empty while employed
+	Position string            `json:"position"`
+	Role     string            `json:"role"`
+}
+
+// a user with the employment seen from a company
+
+type Employee struct {
+	User   User   `json:"user"`
+	WorkAt WorkAt `json:"work_at"`
+}
+
+// a company with the employment seen from a user
+
+type Employer struct {
+	Company Company `json:"company"`
+	WorkAt  WorkAt  `json:"work_at"`
 }
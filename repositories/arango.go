@@ -0,0 +1,373 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// AQL conditions on the edge variable,
+// dates are compared as timestamps because their strings vary in precision
+
+func workAtIsCurrent(e string) string {
+	return "(" + e + ".until == null || DATE_TIMESTAMP(" + e + ".until) > DATE_NOW())"
+}
+
+func workAtIsPast(e string) string {
+	return "(" + e + ".until != null && DATE_TIMESTAMP(" + e + ".until) <= DATE_NOW())"
+}
+
+type arangoCollection struct {
+	db           driver.Database
+	name         string
+	searchFields []string
+}
+
+func NewArangoCompanyRepository(db driver.Database) CompanyRepository {
+	return &companyRepository{
+		collection: &arangoCollection{
+			db:           db,
+			name:         "companies",
+			searchFields: []string{"name"},
+		},
+	}
+}
+
+func NewArangoUserRepository(db driver.Database) UserRepository {
+	return &userRepository{
+		collection: &arangoCollection{
+			db:           db,
+			name:         "users",
+			searchFields: []string{"name", "email"},
+		},
+	}
+}
+
+// arangoError replaces the driver errors with the repository errors
+func arangoError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case driver.IsNotFound(err):
+		return ErrNotFound
+	case driver.IsConflict(err):
+		return ErrConflict
+	case driver.IsPreconditionFailed(err):
+		return ErrPreconditionFailed
+	default:
+		return err
+	}
+}
+
+func (r *arangoCollection) list(ctx context.Context, options ListOptions, docs interface{}) (int64, error) {
+	query := make([]string, 0)
+	query = append(query, "FOR x IN @@collection")
+	bindVars := map[string]interface{}{
+		"@collection": r.name,
+	}
+	if options.OnlyTrashed {
+		query = append(query, "FILTER x.deleted_at != null")
+	} else if !options.WithTrashed {
+		query = append(query, "FILTER x.deleted_at == null")
+	}
+	query = append(query, filterClauses(options.Filter, bindVars)...)
+	if options.Search != "" {
+		matches := []string{}
+		for _, field := range r.searchFields {
+			matches = append(matches, "CONTAINS(LOWER(x."+field+"), LOWER(@search))")
+		}
+		query = append(query, "FILTER "+strings.Join(matches, " || "))
+		bindVars["search"] = options.Search
+	}
+	query = append(query, sortClause(options.Sort))
+	query = append(query, "LIMIT @offset, @limit")
+	bindVars["offset"] = options.Offset
+	bindVars["limit"] = options.Limit
+	query = append(query, "RETURN x")
+	otherCtx := driver.WithQueryFullCount(ctx) // total count ignoring LIMIT
+	cursor, err := r.db.Query(otherCtx, strings.Join(query, " "), bindVars)
+	if err != nil {
+		return 0, arangoError(err)
+	}
+	defer cursor.Close()
+
+	return cursor.Statistics().FullCount(), readDocuments(ctx, cursor, docs)
+}
+
+func (r *arangoCollection) get(ctx context.Context, key string, doc interface{}) error {
+	col, err := r.db.Collection(ctx, r.name)
+	if err != nil {
+		return arangoError(err)
+	}
+	_, err = col.ReadDocument(ctx, key, doc)
+	return arangoError(err)
+}
+
+func (r *arangoCollection) create(ctx context.Context, data map[string]interface{}, doc interface{}) error {
+	col, err := r.db.Collection(ctx, r.name)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	data["created_at"] = now
+	data["updated_at"] = now
+	otherCtx := driver.WithReturnNew(ctx, doc)
+	_, err = col.CreateDocument(otherCtx, data)
+	return arangoError(err)
+}
+
+func (r *arangoCollection) update(ctx context.Context, key string, rev string, data map[string]interface{}, doc interface{}) error {
+	data["updated_at"] = time.Now().UTC()
+	return r.patch(ctx, key, rev, data, doc)
+}
+
+// trash and restore change updated_at too, so If-Modified-Since sees deleted_at changed
+
+func (r *arangoCollection) trash(ctx context.Context, key string, rev string, doc interface{}) error {
+	now := time.Now().UTC()
+	return r.patch(ctx, key, rev, map[string]interface{}{
+		"deleted_at": now,
+		"updated_at": now,
+	}, doc)
+}
+
+func (r *arangoCollection) restore(ctx context.Context, key string, rev string, doc interface{}) error {
+	otherCtx := driver.WithKeepNull(ctx, false) // don't keep empty field
+	return r.patch(otherCtx, key, rev, map[string]interface{}{
+		"deleted_at": nil,
+		"updated_at": time.Now().UTC(),
+	}, doc)
+}
+
+func (r *arangoCollection) patch(ctx context.Context, key string, rev string, data map[string]interface{}, doc interface{}) error {
+	col, err := r.db.Collection(ctx, r.name)
+	if err != nil {
+		return arangoError(err)
+	}
+	otherCtx := driver.WithReturnNew(ctx, doc)
+	otherCtx = driver.WithMergeObjects(otherCtx, false) // replace the objects like thumbnails as a whole
+	if rev != "" {
+		otherCtx = driver.WithRevision(otherCtx, rev) // the server compares it atomically
+	}
+	_, err = col.UpdateDocument(otherCtx, key, data)
+	return arangoError(err)
+}
+
+// erase removes the document with its edges in a single transaction,
+// so the employment graph never has an edge to a missing vertex.
+// it returns the number of the affected edges.
+func (r *arangoCollection) erase(ctx context.Context, key string, rev string, cascade string) (int, error) {
+	tid, err := r.db.BeginTransaction(ctx, driver.TransactionCollections{
+		Write: []string{r.name, "work_at"},
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+	trxCtx := driver.WithTransactionID(ctx, tid)
+	count, err := r.eraseInTransaction(trxCtx, key, rev, cascade)
+	if err != nil {
+		r.db.AbortTransaction(ctx, tid, nil)
+		return 0, arangoError(err)
+	}
+	err = r.db.CommitTransaction(ctx, tid, nil)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *arangoCollection) eraseInTransaction(ctx context.Context, key string, rev string, cascade string) (int, error) {
+	id := r.name + "/" + key
+	if rev != "" {
+		// check the revision first, so nothing is changed on mismatch
+		var doc struct {
+			Rev string `json:"_rev"`
+		}
+		err := r.get(ctx, key, &doc)
+		if err != nil {
+			return 0, err
+		}
+		if doc.Rev != rev {
+			return 0, ErrPreconditionFailed
+		}
+	}
+	switch cascade {
+	case CascadeBlock:
+		query := "RETURN LENGTH(FOR e IN work_at FILTER e._from == @id || e._to == @id LIMIT 1 RETURN 1)"
+		count, err := queryCount(ctx, r.db, query, map[string]interface{}{
+			"id": id,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if count > 0 {
+			return 0, ErrHasEmployment
+		}
+		return 0, r.remove(ctx, key, rev)
+	case CascadeDelete:
+		query := "RETURN LENGTH(FOR e IN work_at FILTER e._from == @id || e._to == @id REMOVE e IN work_at RETURN 1)"
+		count, err := queryCount(ctx, r.db, query, map[string]interface{}{
+			"id": id,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return count, r.remove(ctx, key, rev)
+	case CascadeTrash:
+		now := time.Now().UTC()
+		query := "RETURN LENGTH(FOR e IN work_at FILTER (e._from == @id || e._to == @id) && " + workAtIsCurrent("e") +
+			" UPDATE e WITH { until: @now } IN work_at RETURN 1)"
+		count, err := queryCount(ctx, r.db, query, map[string]interface{}{
+			"id":  id,
+			"now": now,
+		})
+		if err != nil {
+			return 0, err
+		}
+		// keep the moment when it was trashed already
+		query = "LET x = DOCUMENT(@id) FILTER x != null" +
+			" UPDATE x WITH { deleted_at: NOT_NULL(x.deleted_at, @now), updated_at: x.deleted_at == null ? @now : x.updated_at }" +
+			" IN @@collection RETURN 1"
+		updated, err := queryCount(ctx, r.db, "RETURN LENGTH("+query+")", map[string]interface{}{
+			"id":          id,
+			"now":         now,
+			"@collection": r.name,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if updated == 0 {
+			return 0, ErrNotFound
+		}
+		return count, nil
+	default:
+		return 0, fmt.Errorf("unsupported cascade %q", cascade)
+	}
+}
+
+func (r *arangoCollection) remove(ctx context.Context, key string, rev string) error {
+	col, err := r.db.Collection(ctx, r.name)
+	if err != nil {
+		return err
+	}
+	if rev != "" {
+		ctx = driver.WithRevision(ctx, rev)
+	}
+	_, err = col.RemoveDocument(ctx, key)
+	return err
+}
+
+func queryCount(ctx context.Context, db driver.Database, query string, bindVars map[string]interface{}) (int, error) {
+	cursor, err := db.Query(ctx, query, bindVars)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close()
+	var count int
+	_, err = cursor.ReadDocument(ctx, &count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// queryDocuments decodes all results of the query at once into the slice
+func queryDocuments(ctx context.Context, db driver.Database, query string, bindVars map[string]interface{}, docs interface{}) error {
+	cursor, err := db.Query(ctx, query, bindVars)
+	if err != nil {
+		return arangoError(err)
+	}
+	defer cursor.Close()
+	return readDocuments(ctx, cursor, docs)
+}
+
+func readDocuments(ctx context.Context, cursor driver.Cursor, docs interface{}) error {
+	raws := []json.RawMessage{}
+	for {
+		var raw json.RawMessage
+		_, err := cursor.ReadDocument(ctx, &raw)
+		if driver.IsNoMoreDocuments(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+		raws = append(raws, raw)
+	}
+	buf, err := json.Marshal(raws)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, docs)
+}
+
+// sortClause compiles the sort keys into AQL,
+// _key is appended as the last key to make the order stable for pagination.
+func sortClause(sort []SortKey) string {
+	keys := []string{}
+	hasKey := false
+	for _, item := range sort {
+		direction := "ASC"
+		if item.Desc {
+			direction = "DESC"
+		}
+		keys = append(keys, "x."+item.Field+" "+direction)
+		hasKey = hasKey || item.Field == "_key"
+	}
+	if !hasKey {
+		keys = append(keys, "x._key ASC")
+	}
+	return "SORT " + strings.Join(keys, ", ")
+}
+
+// filterClauses compiles the conditions into AQL on the document variable x,
+// field names come from the whitelist and values are always bound
+func filterClauses(conditions []Condition, bindVars map[string]interface{}) []string {
+	clauses := []string{}
+	for i, condition := range conditions {
+		name := "filter" + strconv.Itoa(i)
+		field := "x." + condition.Field
+		bindVars[name] = condition.Value
+		var clause string
+		if _, ok := condition.Value.(time.Time); ok {
+			// dates are compared as timestamps because their strings vary in precision
+			left := "DATE_TIMESTAMP(" + field + ")"
+			right := "DATE_TIMESTAMP(@" + name + ")"
+			switch condition.Operator {
+			case "eq":
+				clause = left + " == " + right
+			case "ne":
+				clause = "(" + field + " == null || " + left + " != " + right + ")"
+			case "gt":
+				clause = field + " != null && " + left + " > " + right
+			case "gte":
+				clause = field + " != null && " + left + " >= " + right
+			case "lt":
+				clause = field + " != null && " + left + " < " + right
+			case "lte":
+				clause = field + " != null && " + left + " <= " + right
+			}
+		} else {
+			switch condition.Operator {
+			case "eq":
+				clause = field + " == @" + name
+			case "ne":
+				clause = field + " != @" + name
+			case "in":
+				clause = field + " IN @" + name
+			case "contains":
+				clause = "CONTAINS(LOWER(" + field + "), LOWER(@" + name + "))"
+			case "starts_with":
+				clause = "LEFT(LOWER(" + field + "), LENGTH(@" + name + ")) == LOWER(@" + name + ")"
+			case "ends_with":
+				clause = "RIGHT(LOWER(" + field + "), LENGTH(@" + name + ")) == LOWER(@" + name + ")"
+			}
+		}
+		clauses = append(clauses, "FILTER "+clause)
+	}
+	return clauses
+}
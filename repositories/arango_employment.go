@@ -0,0 +1,292 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+
+	"groupware-gin/models"
+)
+
+type arangoEmploymentRepository struct {
+	db driver.Database
+}
+
+func NewArangoEmploymentRepository(db driver.Database) EmploymentRepository {
+	return &arangoEmploymentRepository{db: db}
+}
+
+func workAtStatusFilter(status string) string {
+	switch status {
+	case WorkAtAll:
+		return ""
+	case WorkAtPast:
+		return " FILTER " + workAtIsPast("e")
+	default:
+		return " FILTER " + workAtIsCurrent("e")
+	}
+}
+
+func (r *arangoEmploymentRepository) Employees(ctx context.Context, companyKey string, status string) ([]models.Employee, error) {
+	query := "FOR e IN work_at FILTER e._to == @company" + workAtStatusFilter(status) +
+		" LET u = DOCUMENT(e._from) FILTER u != null SORT u.name ASC RETURN { user: u, work_at: e }"
+	employees := []models.Employee{}
+	err := queryDocuments(ctx, r.db, query, map[string]interface{}{
+		"company": "companies/" + companyKey,
+	}, &employees)
+	if err != nil {
+		return nil, err
+	}
+	return employees, nil
+}
+
+func (r *arangoEmploymentRepository) Employers(ctx context.Context, userKey string, status string) ([]models.Employer, error) {
+	query := "FOR e IN work_at FILTER e._from == @user" + workAtStatusFilter(status) +
+		" LET x = DOCUMENT(e._to) FILTER x != null" +
+		" SORT DATE_TIMESTAMP(e.since) ASC, e.until == null ? 1 : 0 ASC, DATE_TIMESTAMP(e.until) ASC" +
+		" RETURN { company: x, work_at: e }"
+	employers := []models.Employer{}
+	err := queryDocuments(ctx, r.db, query, map[string]interface{}{
+		"user": "users/" + userKey,
+	}, &employers)
+	if err != nil {
+		return nil, err
+	}
+	return employers, nil
+}
+
+func (r *arangoEmploymentRepository) Colleagues(ctx context.Context, userKey string) ([]models.Colleague, error) {
+	query := "FOR company, e1 IN 1..1 OUTBOUND @user GRAPH 'employment'" +
+		" FILTER " + workAtIsCurrent("e1") + " && company.deleted_at == null" +
+		" FOR colleague, e2 IN 1..1 INBOUND company GRAPH 'employment'" +
+		" FILTER " + workAtIsCurrent("e2") + " && colleague._id != @user && colleague.deleted_at == null" +
+		" SORT colleague.name ASC, company.name ASC" +
+		" RETURN { user: colleague, company: company, work_at: e2 }"
+	colleagues := []models.Colleague{}
+	err := queryDocuments(ctx, r.db, query, map[string]interface{}{
+		"user": "users/" + userKey,
+	}, &colleagues)
+	if err != nil {
+		return nil, err
+	}
+	return colleagues, nil
+}
+
+// every link is two edges of user -> company <- user
+func (r *arangoEmploymentRepository) Connections(ctx context.Context, userKey string, depth int) ([]models.Connection, error) {
+	query := "FOR v, e, p IN 2..@edges ANY @user GRAPH 'employment'" +
+		" OPTIONS { bfs: true, uniqueVertices: 'path' }" +
+		" PRUNE e != null && NOT " + workAtIsCurrent("e") +
+		" FILTER IS_SAME_COLLECTION('users', v) && v._id != @user" +
+		" FILTER p.edges[* RETURN " + workAtIsCurrent("CURRENT") + "] ALL == true" +
+		" FILTER p.vertices[* RETURN CURRENT.deleted_at == null] ALL == true" +
+		" COLLECT user = v INTO paths = p" +
+		" LET path = FIRST(FOR x IN paths SORT LENGTH(x.edges) ASC LIMIT 1 RETURN x)" +
+		" LET degree = LENGTH(path.edges) / 2" +
+		" SORT degree ASC, user.name ASC" +
+		" RETURN {" +
+		" user: user," +
+		" degree: degree," +
+		" path: (FOR i IN 0..(degree - 1) RETURN { from: path.vertices[i * 2], company: path.vertices[i * 2 + 1], to: path.vertices[i * 2 + 2] })" +
+		" }"
+	connections := []models.Connection{}
+	err := queryDocuments(ctx, r.db, query, map[string]interface{}{
+		"user":  "users/" + userKey,
+		"edges": depth * 2,
+	}, &connections)
+	if err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+func (r *arangoEmploymentRepository) Current(ctx context.Context, userKey string, companyKey string) (*models.WorkAt, error) {
+	query := "FOR e IN work_at FILTER e._from == @user && e._to == @company && " + workAtIsCurrent("e") +
+		" SORT DATE_TIMESTAMP(e.since) DESC LIMIT 1 RETURN e"
+	edges := []models.WorkAt{}
+	err := queryDocuments(ctx, r.db, query, map[string]interface{}{
+		"user":    "users/" + userKey,
+		"company": "companies/" + companyKey,
+	}, &edges)
+	if err != nil {
+		return nil, err
+	}
+	if len(edges) == 0 {
+		return nil, ErrNotFound
+	}
+	return &edges[0], nil
+}
+
+// being admin in the past gives nothing
+func (r *arangoEmploymentRepository) IsCompanyAdmin(ctx context.Context, userKey string, companyKey string) (bool, error) {
+	query := "RETURN LENGTH(FOR e IN work_at FILTER e._from == @user && e._to == @company && e.role == @role && " + workAtIsCurrent("e") +
+		" LIMIT 1 RETURN 1)"
+	count, err := queryCount(ctx, r.db, query, map[string]interface{}{
+		"user":    "users/" + userKey,
+		"company": "companies/" + companyKey,
+		"role":    models.RoleAdmin,
+	})
+	return count > 0, err
+}
+
+func (r *arangoEmploymentRepository) Create(ctx context.Context, edge models.WorkAt) (*models.WorkAt, error) {
+	return r.inTransaction(ctx, func(ctx context.Context) (*models.WorkAt, error) {
+		err := r.checkOverlap(ctx, edge.From, edge.To, edge.Since, edge.Until, "")
+		if err != nil {
+			return nil, err
+		}
+		return r.create(ctx, edge)
+	})
+}
+
+func (r *arangoEmploymentRepository) Update(ctx context.Context, key string, patch WorkAtPatch) (*models.WorkAt, error) {
+	return r.inTransaction(ctx, func(ctx context.Context) (*models.WorkAt, error) {
+		edge, err := r.get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		data := map[string]interface{}{}
+		if patch.Since != nil {
+			edge.Since = *patch.Since
+			data["since"] = *patch.Since
+		}
+		if patch.Until != nil {
+			edge.Until = patch.Until
+			data["until"] = *patch.Until
+		}
+		if patch.Position != nil {
+			data["position"] = *patch.Position
+		}
+		if patch.Role != nil {
+			data["role"] = *patch.Role
+		}
+		err = r.checkOverlap(ctx, edge.From, edge.To, edge.Since, edge.Until, key)
+		if err != nil {
+			return nil, err
+		}
+		return r.update(ctx, key, data)
+	})
+}
+
+// Move ends the edge and creates the next one in a single transaction,
+// so the user never loses the current employment when the create fails
+func (r *arangoEmploymentRepository) Move(ctx context.Context, key string, next models.WorkAt) (*models.WorkAt, error) {
+	return r.inTransaction(ctx, func(ctx context.Context) (*models.WorkAt, error) {
+		_, err := r.get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		err = r.checkOverlap(ctx, next.From, next.To, next.Since, next.Until, "")
+		if err != nil {
+			return nil, err
+		}
+		_, err = r.update(ctx, key, map[string]interface{}{
+			"until": next.Since,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return r.create(ctx, next)
+	})
+}
+
+func (r *arangoEmploymentRepository) Erase(ctx context.Context, key string) error {
+	col, err := r.db.Collection(ctx, "work_at")
+	if err != nil {
+		return err
+	}
+	_, err = col.RemoveDocument(ctx, key)
+	return arangoError(err)
+}
+
+func (r *arangoEmploymentRepository) RemoveDangling(ctx context.Context) (int, error) {
+	query := "RETURN LENGTH(FOR e IN work_at FILTER DOCUMENT(e._from) == null || DOCUMENT(e._to) == null REMOVE e IN work_at RETURN 1)"
+	return queryCount(ctx, r.db, query, nil)
+}
+
+// inTransaction locks work_at exclusively during the writes,
+// so no other edge is written between the overlap check and the write
+func (r *arangoEmploymentRepository) inTransaction(ctx context.Context, write func(ctx context.Context) (*models.WorkAt, error)) (*models.WorkAt, error) {
+	tid, err := r.db.BeginTransaction(ctx, driver.TransactionCollections{
+		Exclusive: []string{"work_at"},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	trxCtx := driver.WithTransactionID(ctx, tid)
+	doc, err := write(trxCtx)
+	if err != nil {
+		r.db.AbortTransaction(ctx, tid, nil)
+		return nil, err
+	}
+	err = r.db.CommitTransaction(ctx, tid, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (r *arangoEmploymentRepository) get(ctx context.Context, key string) (*models.WorkAt, error) {
+	col, err := r.db.Collection(ctx, "work_at")
+	if err != nil {
+		return nil, err
+	}
+	var doc models.WorkAt
+	_, err = col.ReadDocument(ctx, key, &doc)
+	if err != nil {
+		return nil, arangoError(err)
+	}
+	return &doc, nil
+}
+
+func (r *arangoEmploymentRepository) create(ctx context.Context, edge models.WorkAt) (*models.WorkAt, error) {
+	col, err := r.db.Collection(ctx, "work_at")
+	if err != nil {
+		return nil, err
+	}
+	var doc models.WorkAt
+	otherCtx := driver.WithReturnNew(ctx, &doc)
+	_, err = col.CreateDocument(otherCtx, edge)
+	if err != nil {
+		return nil, arangoError(err)
+	}
+	return &doc, nil
+}
+
+func (r *arangoEmploymentRepository) update(ctx context.Context, key string, data map[string]interface{}) (*models.WorkAt, error) {
+	col, err := r.db.Collection(ctx, "work_at")
+	if err != nil {
+		return nil, err
+	}
+	var doc models.WorkAt
+	otherCtx := driver.WithReturnNew(ctx, &doc)
+	_, err = col.UpdateDocument(otherCtx, key, data)
+	if err != nil {
+		return nil, arangoError(err)
+	}
+	return &doc, nil
+}
+
+// two periods overlap when each one starts before the other ends,
+// the empty until means the employment continues forever
+func (r *arangoEmploymentRepository) checkOverlap(ctx context.Context, from string, to string, since time.Time, until *time.Time, exceptKey string) error {
+	query := "RETURN LENGTH(FOR e IN work_at FILTER e._from == @user && e._to == @company && e._key != @except" +
+		" FILTER e.until == null || DATE_TIMESTAMP(e.until) > DATE_TIMESTAMP(@since)" +
+		" FILTER @until == null || DATE_TIMESTAMP(e.since) < DATE_TIMESTAMP(@until)" +
+		" LIMIT 1 RETURN 1)"
+	count, err := queryCount(ctx, r.db, query, map[string]interface{}{
+		"user":    from,
+		"company": to,
+		"except":  exceptKey,
+		"since":   since,
+		"until":   until,
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrOverlapped
+	}
+	return nil
+}
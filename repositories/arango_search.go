@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	driver "github.com/arangodb/go-driver"
+
+	"groupware-gin/models"
+)
+
+// the names of the view and the analyzer, that the migration creates
+const (
+	SearchView     = "directory_view"
+	SearchAnalyzer = "directory_text"
+)
+
+type arangoSearchRepository struct {
+	db driver.Database
+}
+
+func NewArangoSearchRepository(db driver.Database) SearchRepository {
+	return &arangoSearchRepository{db: db}
+}
+
+// every word must match a field exactly, as a prefix or with a few typos
+func (r *arangoSearchRepository) Search(ctx context.Context, options SearchOptions) ([]models.SearchResult, int64, error) {
+	// split the words in the same way as the indexed fields
+	tokens, err := r.tokens(ctx, options.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(tokens) == 0 {
+		return []models.SearchResult{}, 0, nil
+	}
+
+	query := make([]string, 0)
+	query = append(query, "FOR d IN "+SearchView)
+	bindVars := map[string]interface{}{}
+	conditions := []string{}
+	for i, token := range tokens {
+		name := "token" + strconv.Itoa(i)
+		bindVars[name] = token
+		distance := "0"
+		if len(token) >= 8 {
+			distance = "2"
+		} else if len(token) >= 4 {
+			distance = "1"
+		}
+		matches := []string{}
+		for _, field := range []string{"d.name", "d.email"} {
+			matches = append(matches,
+				field+" == @"+name,
+				"STARTS_WITH("+field+", @"+name+")",
+				"LEVENSHTEIN_MATCH("+field+", @"+name+", "+distance+")",
+			)
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+	}
+	query = append(query, "SEARCH ANALYZER("+strings.Join(conditions, " AND ")+", '"+SearchAnalyzer+"')")
+	query = append(query, "FILTER d.deleted_at == null")
+	if options.Type == "user" {
+		query = append(query, "FILTER IS_SAME_COLLECTION('users', d)")
+	} else if options.Type == "company" {
+		query = append(query, "FILTER IS_SAME_COLLECTION('companies', d)")
+	}
+	query = append(query, "LET score = BM25(d)")
+	query = append(query, "SORT score DESC, d._id ASC")
+	query = append(query, "LIMIT @offset, @limit")
+	bindVars["offset"] = options.Offset
+	bindVars["limit"] = options.Limit
+	query = append(query, "RETURN { type: IS_SAME_COLLECTION('users', d) ? 'user' : 'company', score: score, document: UNSET(d, 'password') }")
+	otherCtx := driver.WithQueryFullCount(ctx) // total count ignoring LIMIT
+	cursor, err := r.db.Query(otherCtx, strings.Join(query, " "), bindVars)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close()
+
+	// make the typed documents
+	docs := []struct {
+		Type     string          `json:"type"`
+		Score    float64         `json:"score"`
+		Document json.RawMessage `json:"document"`
+	}{}
+	err = readDocuments(ctx, cursor, &docs)
+	if err != nil {
+		return nil, 0, err
+	}
+	results := []models.SearchResult{}
+	for _, doc := range docs {
+		result, err := searchResult(doc.Type, doc.Score, doc.Document)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, result)
+	}
+	return results, cursor.Statistics().FullCount(), nil
+}
+
+func (r *arangoSearchRepository) tokens(ctx context.Context, q string) ([]string, error) {
+	cursor, err := r.db.Query(ctx, "RETURN TOKENS(@q, @analyzer)", map[string]interface{}{
+		"q":        q,
+		"analyzer": SearchAnalyzer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+	tokens := []string{}
+	_, err = cursor.ReadDocument(ctx, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// searchResult decodes the document by its type
+func searchResult(kind string, score float64, document interface{}) (models.SearchResult, error) {
+	result := models.SearchResult{
+		Type:  kind,
+		Score: score,
+	}
+	var err error
+	if kind == "user" {
+		var user models.User
+		err = decodeDocument(document, &user)
+		result.Document = user
+	} else {
+		var company models.Company
+		err = decodeDocument(document, &company)
+		result.Document = company
+	}
+	return result, err
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+
+	driver "github.com/arangodb/go-driver"
+
+	"groupware-gin/models"
+)
+
+type arangoTokenRepository struct {
+	db driver.Database
+}
+
+func NewArangoTokenRepository(db driver.Database) TokenRepository {
+	return &arangoTokenRepository{db: db}
+}
+
+func (r *arangoTokenRepository) Get(ctx context.Context, key string) (*models.RefreshToken, error) {
+	col, err := r.db.Collection(ctx, "refresh_tokens")
+	if err != nil {
+		return nil, err
+	}
+	var doc models.RefreshToken
+	_, err = col.ReadDocument(ctx, key, &doc)
+	if err != nil {
+		return nil, arangoError(err)
+	}
+	return &doc, nil
+}
+
+func (r *arangoTokenRepository) Create(ctx context.Context, token models.RefreshToken) error {
+	col, err := r.db.Collection(ctx, "refresh_tokens")
+	if err != nil {
+		return err
+	}
+	_, err = col.CreateDocument(ctx, token)
+	return arangoError(err)
+}
+
+// Replace sets replaced_by only while it is empty, so one of the concurrent refreshes wins
+func (r *arangoTokenRepository) Replace(ctx context.Context, key string, next string) error {
+	query := "RETURN LENGTH(FOR x IN refresh_tokens FILTER x._key == @key && x.replaced_by == null" +
+		" UPDATE x WITH { replaced_by: @next } IN refresh_tokens RETURN 1)"
+	count, err := queryCount(ctx, r.db, query, map[string]interface{}{
+		"key":  key,
+		"next": next,
+	})
+	if err != nil {
+		return arangoError(err) // the write conflict of the concurrent one
+	}
+	if count == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *arangoTokenRepository) Delete(ctx context.Context, key string) error {
+	col, err := r.db.Collection(ctx, "refresh_tokens")
+	if err != nil {
+		return err
+	}
+	_, err = col.RemoveDocument(ctx, key)
+	return arangoError(err)
+}
+
+func (r *arangoTokenRepository) RevokeFamily(ctx context.Context, family string) error {
+	query := "FOR x IN refresh_tokens FILTER x.family == @family REMOVE x IN refresh_tokens"
+	cursor, err := r.db.Query(ctx, query, map[string]interface{}{
+		"family": family,
+	})
+	if err != nil {
+		return err
+	}
+	return cursor.Close()
+}
@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+
+	"groupware-gin/models"
+)
+
+// the names are unique regardless of the case, by the unique index on
+// the lower case copy "name_lower" that is never returned
+type companyRepository struct {
+	collection documentCollection
+}
+
+func (r *companyRepository) List(ctx context.Context, options ListOptions) ([]models.Company, int64, error) {
+	companies := []models.Company{}
+	total, err := r.collection.list(ctx, options, &companies)
+	if err != nil {
+		return nil, 0, err
+	}
+	return companies, total, nil
+}
+
+func (r *companyRepository) Get(ctx context.Context, key string) (*models.Company, error) {
+	var doc models.Company
+	err := r.collection.get(ctx, key, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *companyRepository) Create(ctx context.Context, company models.Company) (*models.Company, error) {
+	var doc models.Company
+	err := r.collection.create(ctx, map[string]interface{}{
+		"name":       company.Name,
+		"name_lower": strings.ToLower(company.Name),
+		"since":      company.Since,
+	}, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *companyRepository) Update(ctx context.Context, key string, rev string, patch CompanyPatch) (*models.Company, error) {
+	data := map[string]interface{}{}
+	if patch.Name != nil {
+		data["name"] = *patch.Name
+		data["name_lower"] = strings.ToLower(*patch.Name)
+	}
+	if patch.Since != nil {
+		data["since"] = *patch.Since
+	}
+	var doc models.Company
+	err := r.collection.update(ctx, key, rev, data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *companyRepository) Trash(ctx context.Context, key string, rev string) (*models.Company, error) {
+	var doc models.Company
+	err := r.collection.trash(ctx, key, rev, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *companyRepository) Restore(ctx context.Context, key string, rev string) (*models.Company, error) {
+	var doc models.Company
+	err := r.collection.restore(ctx, key, rev, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *companyRepository) Erase(ctx context.Context, key string, rev string, cascade string) (int, error) {
+	return r.collection.erase(ctx, key, rev, cascade)
+}
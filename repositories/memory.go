@@ -0,0 +1,485 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the collections in memory for tests without ArangoDB,
+// documents are stored as decoded JSON so they compare in the same way as the stored ones
+type MemoryStore struct {
+	mu          sync.Mutex
+	collections map[string]map[string]map[string]interface{} // collection -> key -> document
+	sequence    int64                                        // for keys and revisions
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		collections: map[string]map[string]map[string]interface{}{},
+	}
+}
+
+func (m *MemoryStore) Companies() CompanyRepository {
+	return &companyRepository{
+		collection: &memoryCollection{
+			store:        m,
+			name:         "companies",
+			searchFields: []string{"name"},
+			uniqueFields: []string{"name_lower"},
+		},
+	}
+}
+
+func (m *MemoryStore) Users() UserRepository {
+	return &userRepository{
+		collection: &memoryCollection{
+			store:        m,
+			name:         "users",
+			searchFields: []string{"name", "email"},
+			uniqueFields: []string{"email"},
+		},
+	}
+}
+
+// Insert stores a raw document like a user with password or a work_at edge with _from and _to,
+// and returns the stored document with _key, _id and _rev
+func (m *MemoryStore) Insert(collection string, data map[string]interface{}) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insert(collection, data)
+}
+
+// Document returns a copy of the raw document, or ErrNotFound
+func (m *MemoryStore) Document(collection string, key string) (map[string]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, found := m.collections[collection][key]
+	if !found {
+		return nil, ErrNotFound
+	}
+	return copyDocument(doc), nil
+}
+
+// Documents returns copies of all raw documents in the collection, ordered by _key
+func (m *MemoryStore) Documents(collection string) []map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	docs := []map[string]interface{}{}
+	for _, doc := range m.collections[collection] {
+		docs = append(docs, copyDocument(doc))
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return compareValues(docs[i]["_key"], docs[j]["_key"]) < 0
+	})
+	return docs
+}
+
+func (m *MemoryStore) nextSequence() string {
+	m.sequence++
+	return strconv.FormatInt(m.sequence, 10)
+}
+
+func (m *MemoryStore) insert(collection string, data map[string]interface{}) (map[string]interface{}, error) {
+	doc, err := normalizeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := doc["_key"].(string)
+	if key == "" {
+		key = m.nextSequence()
+	}
+	if m.collections[collection] == nil {
+		m.collections[collection] = map[string]map[string]interface{}{}
+	}
+	if _, found := m.collections[collection][key]; found {
+		return nil, ErrConflict
+	}
+	doc["_key"] = key
+	doc["_id"] = collection + "/" + key
+	doc["_rev"] = "_" + m.nextSequence()
+	m.collections[collection][key] = doc
+	return copyDocument(doc), nil
+}
+
+// patch merges the data into the document like UpdateDocument,
+// nil values remove the fields like keepNull false
+func (m *MemoryStore) patch(collection string, key string, rev string, data map[string]interface{}) (map[string]interface{}, error) {
+	doc, found := m.collections[collection][key]
+	if !found {
+		return nil, ErrNotFound
+	}
+	if rev != "" && doc["_rev"] != rev {
+		return nil, ErrPreconditionFailed
+	}
+	values, err := normalizeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range values {
+		if value == nil {
+			delete(doc, name)
+		} else {
+			doc[name] = value
+		}
+	}
+	doc["_rev"] = "_" + m.nextSequence()
+	return copyDocument(doc), nil
+}
+
+type memoryCollection struct {
+	store        *MemoryStore
+	name         string
+	searchFields []string
+	uniqueFields []string // the same as the unique indexes
+}
+
+// checkUnique returns ErrConflict if another document has the same value in a unique field
+func (r *memoryCollection) checkUnique(key string, data map[string]interface{}) error {
+	values, err := normalizeDocument(data)
+	if err != nil {
+		return err
+	}
+	for _, field := range r.uniqueFields {
+		value, found := values[field]
+		if !found || value == nil {
+			continue
+		}
+		for otherKey, doc := range r.store.collections[r.name] {
+			if otherKey != key && doc[field] == value {
+				return ErrConflict
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memoryCollection) list(ctx context.Context, options ListOptions, docs interface{}) (int64, error) {
+	r.store.mu.Lock()
+	matched := []map[string]interface{}{}
+	for _, doc := range r.store.collections[r.name] {
+		if matchDocument(doc, options, r.searchFields) {
+			matched = append(matched, copyDocument(doc))
+		}
+	}
+	r.store.mu.Unlock()
+
+	keys := append([]SortKey{}, options.Sort...)
+	keys = append(keys, SortKey{Field: "_key"}) // stable order for pagination
+	sort.SliceStable(matched, func(i, j int) bool {
+		for _, key := range keys {
+			result := compareValues(matched[i][key.Field], matched[j][key.Field])
+			if result != 0 {
+				return (result < 0) != key.Desc
+			}
+		}
+		return false
+	})
+	total := int64(len(matched))
+	start := options.Offset
+	if start > len(matched) {
+		start = len(matched)
+	}
+	end := start + options.Limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+	return total, decodeDocument(matched[start:end], docs)
+}
+
+func (r *memoryCollection) get(ctx context.Context, key string, doc interface{}) error {
+	found, err := r.store.Document(r.name, key)
+	if err != nil {
+		return err
+	}
+	return decodeDocument(found, doc)
+}
+
+func (r *memoryCollection) create(ctx context.Context, data map[string]interface{}, doc interface{}) error {
+	now := time.Now().UTC()
+	data["created_at"] = now
+	data["updated_at"] = now
+	r.store.mu.Lock()
+	err := r.checkUnique("", data)
+	var created map[string]interface{}
+	if err == nil {
+		created, err = r.store.insert(r.name, data)
+	}
+	r.store.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return decodeDocument(created, doc)
+}
+
+func (r *memoryCollection) update(ctx context.Context, key string, rev string, data map[string]interface{}, doc interface{}) error {
+	data["updated_at"] = time.Now().UTC()
+	return r.patch(key, rev, data, doc)
+}
+
+func (r *memoryCollection) trash(ctx context.Context, key string, rev string, doc interface{}) error {
+	now := time.Now().UTC()
+	return r.patch(key, rev, map[string]interface{}{
+		"deleted_at": now,
+		"updated_at": now,
+	}, doc)
+}
+
+func (r *memoryCollection) restore(ctx context.Context, key string, rev string, doc interface{}) error {
+	return r.patch(key, rev, map[string]interface{}{
+		"deleted_at": nil,
+		"updated_at": time.Now().UTC(),
+	}, doc)
+}
+
+func (r *memoryCollection) patch(key string, rev string, data map[string]interface{}, doc interface{}) error {
+	r.store.mu.Lock()
+	// like ArangoDB, a missing document or a stale revision wins over a unique violation
+	var err error
+	existing, found := r.store.collections[r.name][key]
+	switch {
+	case !found:
+		err = ErrNotFound
+	case rev != "" && existing["_rev"] != rev:
+		err = ErrPreconditionFailed
+	default:
+		err = r.checkUnique(key, data)
+	}
+	var updated map[string]interface{}
+	if err == nil {
+		updated, err = r.store.patch(r.name, key, rev, data)
+	}
+	r.store.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return decodeDocument(updated, doc)
+}
+
+// erase holds the lock during the whole cascade like the transaction of ArangoDB
+func (r *memoryCollection) erase(ctx context.Context, key string, rev string, cascade string) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	doc, found := r.store.collections[r.name][key]
+	if !found {
+		return 0, ErrNotFound
+	}
+	if rev != "" && doc["_rev"] != rev {
+		return 0, ErrPreconditionFailed
+	}
+	id := r.name + "/" + key
+	edges := []map[string]interface{}{}
+	for _, edge := range r.store.collections["work_at"] {
+		if edge["_from"] == id || edge["_to"] == id {
+			edges = append(edges, edge)
+		}
+	}
+	switch cascade {
+	case CascadeBlock:
+		if len(edges) > 0 {
+			return 0, ErrHasEmployment
+		}
+		delete(r.store.collections[r.name], key)
+		return 0, nil
+	case CascadeDelete:
+		for _, edge := range edges {
+			delete(r.store.collections["work_at"], edge["_key"].(string))
+		}
+		delete(r.store.collections[r.name], key)
+		return len(edges), nil
+	case CascadeTrash:
+		now := time.Now().UTC()
+		count := 0
+		for _, edge := range edges {
+			if !isCurrentEdge(edge, now) {
+				continue
+			}
+			_, err := r.store.patch("work_at", edge["_key"].(string), "", map[string]interface{}{
+				"until": now,
+			})
+			if err != nil {
+				return 0, err
+			}
+			count++
+		}
+		// keep the moment when it was trashed already
+		if doc["deleted_at"] == nil {
+			_, err := r.store.patch(r.name, key, "", map[string]interface{}{
+				"deleted_at": now,
+				"updated_at": now,
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+		return count, nil
+	default:
+		return 0, fmt.Errorf("unsupported cascade %q", cascade)
+	}
+}
+
+// the same as workAtIsCurrent
+func isCurrentEdge(edge map[string]interface{}, now time.Time) bool {
+	until, ok := parseTime(edge["until"])
+	return !ok || until.After(now)
+}
+
+func matchDocument(doc map[string]interface{}, options ListOptions, searchFields []string) bool {
+	if options.OnlyTrashed && doc["deleted_at"] == nil {
+		return false
+	}
+	if !options.OnlyTrashed && !options.WithTrashed && doc["deleted_at"] != nil {
+		return false
+	}
+	for _, condition := range options.Filter {
+		if !matchCondition(doc[condition.Field], condition) {
+			return false
+		}
+	}
+	if options.Search != "" {
+		search := strings.ToLower(options.Search)
+		for _, field := range searchFields {
+			if strings.Contains(strings.ToLower(stringValue(doc[field])), search) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// matchCondition evaluates a condition in the same way as filterClauses
+func matchCondition(value interface{}, condition Condition) bool {
+	if expected, ok := condition.Value.(time.Time); ok {
+		actual, ok := parseTime(value)
+		if !ok {
+			return condition.Operator == "ne"
+		}
+		switch condition.Operator {
+		case "eq":
+			return actual.Equal(expected)
+		case "ne":
+			return !actual.Equal(expected)
+		case "gt":
+			return actual.After(expected)
+		case "gte":
+			return !actual.Before(expected)
+		case "lt":
+			return actual.Before(expected)
+		case "lte":
+			return !actual.After(expected)
+		}
+		return false
+	}
+	text := stringValue(value)
+	switch condition.Operator {
+	case "eq":
+		return value != nil && text == condition.Value
+	case "ne":
+		return value == nil || text != condition.Value
+	case "in":
+		if value == nil {
+			return false
+		}
+		for _, item := range condition.Value.([]string) {
+			if text == item {
+				return true
+			}
+		}
+		return false
+	case "contains":
+		return strings.Contains(strings.ToLower(text), strings.ToLower(condition.Value.(string)))
+	case "starts_with":
+		return strings.HasPrefix(strings.ToLower(text), strings.ToLower(condition.Value.(string)))
+	case "ends_with":
+		return strings.HasSuffix(strings.ToLower(text), strings.ToLower(condition.Value.(string)))
+	}
+	return false
+}
+
+// compareValues orders the values like AQL: null < bool < number < string
+func compareValues(a interface{}, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case nil:
+			return 0
+		case bool:
+			return 1
+		case float64:
+			return 2
+		case string:
+			return 3
+		default:
+			return 4
+		}
+	}
+	if rank(a) != rank(b) {
+		return rank(a) - rank(b)
+	}
+	switch x := a.(type) {
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		} else if !x {
+			return -1
+		}
+		return 1
+	case float64:
+		y := b.(float64)
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	}
+	return 0
+}
+
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func parseTime(value interface{}) (time.Time, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, text)
+	return t, err == nil
+}
+
+// normalizeDocument converts the values into the decoded JSON,
+// so times become strings in the same format as the stored ones
+func normalizeDocument(data map[string]interface{}) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	return doc, decodeDocument(data, &doc)
+}
+
+func copyDocument(doc map[string]interface{}) map[string]interface{} {
+	result, _ := normalizeDocument(doc)
+	return result
+}
+
+func decodeDocument(value interface{}, doc interface{}) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, doc)
+}
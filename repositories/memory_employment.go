@@ -0,0 +1,360 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"groupware-gin/models"
+)
+
+type memoryEmploymentRepository struct {
+	store *MemoryStore
+}
+
+func (m *MemoryStore) Employment() EmploymentRepository {
+	return &memoryEmploymentRepository{store: m}
+}
+
+// vertex returns the document of the edge end like users/1, or nil if missing
+func (r *memoryEmploymentRepository) vertex(id string) map[string]interface{} {
+	parts := strings.SplitN(id, "/", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	return r.store.collections[parts[0]][parts[1]]
+}
+
+// edges returns the work_at edges that match, ordered by _key
+func (r *memoryEmploymentRepository) edges(match func(edge map[string]interface{}) bool) []map[string]interface{} {
+	edges := []map[string]interface{}{}
+	for _, edge := range r.store.collections["work_at"] {
+		if match(edge) {
+			edges = append(edges, edge)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return compareValues(edges[i]["_key"], edges[j]["_key"]) < 0
+	})
+	return edges
+}
+
+func matchWorkAtStatus(edge map[string]interface{}, status string, now time.Time) bool {
+	switch status {
+	case WorkAtAll:
+		return true
+	case WorkAtPast:
+		return !isCurrentEdge(edge, now)
+	default:
+		return isCurrentEdge(edge, now)
+	}
+}
+
+func (r *memoryEmploymentRepository) Employees(ctx context.Context, companyKey string, status string) ([]models.Employee, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	now := time.Now().UTC()
+	results := []map[string]interface{}{}
+	for _, edge := range r.edges(func(edge map[string]interface{}) bool {
+		return edge["_to"] == "companies/"+companyKey && matchWorkAtStatus(edge, status, now)
+	}) {
+		user := r.vertex(edge["_from"].(string))
+		if user != nil {
+			results = append(results, map[string]interface{}{"user": user, "work_at": edge})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return compareValues(results[i]["user"].(map[string]interface{})["name"], results[j]["user"].(map[string]interface{})["name"]) < 0
+	})
+	employees := []models.Employee{}
+	err := decodeDocument(results, &employees)
+	if err != nil {
+		return nil, err
+	}
+	return employees, nil
+}
+
+func (r *memoryEmploymentRepository) Employers(ctx context.Context, userKey string, status string) ([]models.Employer, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	now := time.Now().UTC()
+	results := []map[string]interface{}{}
+	for _, edge := range r.edges(func(edge map[string]interface{}) bool {
+		return edge["_from"] == "users/"+userKey && matchWorkAtStatus(edge, status, now)
+	}) {
+		company := r.vertex(edge["_to"].(string))
+		if company != nil {
+			results = append(results, map[string]interface{}{"company": company, "work_at": edge})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a := results[i]["work_at"].(map[string]interface{})
+		b := results[j]["work_at"].(map[string]interface{})
+		sinceA, _ := parseTime(a["since"])
+		sinceB, _ := parseTime(b["since"])
+		if !sinceA.Equal(sinceB) {
+			return sinceA.Before(sinceB)
+		}
+		untilA, endedA := parseTime(a["until"])
+		untilB, endedB := parseTime(b["until"])
+		if endedA != endedB {
+			return endedA // the current one comes last
+		}
+		return untilA.Before(untilB)
+	})
+	employers := []models.Employer{}
+	err := decodeDocument(results, &employers)
+	if err != nil {
+		return nil, err
+	}
+	return employers, nil
+}
+
+func (r *memoryEmploymentRepository) Colleagues(ctx context.Context, userKey string) ([]models.Colleague, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	now := time.Now().UTC()
+	userID := "users/" + userKey
+	results := []map[string]interface{}{}
+	for _, e1 := range r.edges(func(edge map[string]interface{}) bool {
+		return edge["_from"] == userID && isCurrentEdge(edge, now)
+	}) {
+		company := r.vertex(e1["_to"].(string))
+		if company == nil || company["deleted_at"] != nil {
+			continue
+		}
+		for _, e2 := range r.edges(func(edge map[string]interface{}) bool {
+			return edge["_to"] == e1["_to"] && edge["_from"] != userID && isCurrentEdge(edge, now)
+		}) {
+			colleague := r.vertex(e2["_from"].(string))
+			if colleague == nil || colleague["deleted_at"] != nil {
+				continue
+			}
+			results = append(results, map[string]interface{}{"user": colleague, "company": company, "work_at": e2})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		for _, field := range []string{"user", "company"} {
+			result := compareValues(results[i][field].(map[string]interface{})["name"], results[j][field].(map[string]interface{})["name"])
+			if result != 0 {
+				return result < 0
+			}
+		}
+		return false
+	})
+	colleagues := []models.Colleague{}
+	err := decodeDocument(results, &colleagues)
+	if err != nil {
+		return nil, err
+	}
+	return colleagues, nil
+}
+
+// Connections walks the graph breadth first like the traversal of ArangoDB,
+// so the first path found to each user is one of the shortest
+func (r *memoryEmploymentRepository) Connections(ctx context.Context, userKey string, depth int) ([]models.Connection, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	now := time.Now().UTC()
+	start := "users/" + userKey
+	if user := r.vertex(start); user == nil || user["deleted_at"] != nil {
+		return []models.Connection{}, nil
+	}
+	paths := map[string][]map[string]interface{}{start: {}}
+	frontier := []string{start}
+	results := []map[string]interface{}{}
+	for degree := 1; degree <= depth && len(frontier) > 0; degree++ {
+		next := []string{}
+		for _, from := range frontier {
+			for _, e1 := range r.edges(func(edge map[string]interface{}) bool {
+				return edge["_from"] == from && isCurrentEdge(edge, now)
+			}) {
+				company := r.vertex(e1["_to"].(string))
+				if company == nil || company["deleted_at"] != nil {
+					continue
+				}
+				for _, e2 := range r.edges(func(edge map[string]interface{}) bool {
+					return edge["_to"] == e1["_to"] && isCurrentEdge(edge, now)
+				}) {
+					to := e2["_from"].(string)
+					user := r.vertex(to)
+					if _, found := paths[to]; found || user == nil || user["deleted_at"] != nil {
+						continue
+					}
+					link := map[string]interface{}{"from": r.vertex(from), "company": company, "to": user}
+					paths[to] = append(append([]map[string]interface{}{}, paths[from]...), link)
+					next = append(next, to)
+					results = append(results, map[string]interface{}{"user": user, "degree": degree, "path": paths[to]})
+				}
+			}
+		}
+		frontier = next
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i]["degree"] != results[j]["degree"] {
+			return results[i]["degree"].(int) < results[j]["degree"].(int)
+		}
+		return compareValues(results[i]["user"].(map[string]interface{})["name"], results[j]["user"].(map[string]interface{})["name"]) < 0
+	})
+	connections := []models.Connection{}
+	err := decodeDocument(results, &connections)
+	if err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+func (r *memoryEmploymentRepository) Current(ctx context.Context, userKey string, companyKey string) (*models.WorkAt, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	now := time.Now().UTC()
+	var current map[string]interface{}
+	var latest time.Time
+	for _, edge := range r.edges(func(edge map[string]interface{}) bool {
+		return edge["_from"] == "users/"+userKey && edge["_to"] == "companies/"+companyKey && isCurrentEdge(edge, now)
+	}) {
+		since, _ := parseTime(edge["since"])
+		if current == nil || since.After(latest) {
+			current, latest = edge, since
+		}
+	}
+	if current == nil {
+		return nil, ErrNotFound
+	}
+	var doc models.WorkAt
+	return &doc, decodeDocument(current, &doc)
+}
+
+func (r *memoryEmploymentRepository) IsCompanyAdmin(ctx context.Context, userKey string, companyKey string) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	now := time.Now().UTC()
+	edges := r.edges(func(edge map[string]interface{}) bool {
+		return edge["_from"] == "users/"+userKey && edge["_to"] == "companies/"+companyKey &&
+			edge["role"] == models.RoleAdmin && isCurrentEdge(edge, now)
+	})
+	return len(edges) > 0, nil
+}
+
+func (r *memoryEmploymentRepository) Create(ctx context.Context, edge models.WorkAt) (*models.WorkAt, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	err := r.checkOverlap(edge.From, edge.To, edge.Since, edge.Until, "")
+	if err != nil {
+		return nil, err
+	}
+	return r.insert(edge)
+}
+
+func (r *memoryEmploymentRepository) Update(ctx context.Context, key string, patch WorkAtPatch) (*models.WorkAt, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	edge, found := r.store.collections["work_at"][key]
+	if !found {
+		return nil, ErrNotFound
+	}
+	since, _ := parseTime(edge["since"])
+	var until *time.Time
+	if t, ok := parseTime(edge["until"]); ok {
+		until = &t
+	}
+	data := map[string]interface{}{}
+	if patch.Since != nil {
+		since = *patch.Since
+		data["since"] = *patch.Since
+	}
+	if patch.Until != nil {
+		until = patch.Until
+		data["until"] = *patch.Until
+	}
+	if patch.Position != nil {
+		data["position"] = *patch.Position
+	}
+	if patch.Role != nil {
+		data["role"] = *patch.Role
+	}
+	err := r.checkOverlap(edge["_from"].(string), edge["_to"].(string), since, until, key)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := r.store.patch("work_at", key, "", data)
+	if err != nil {
+		return nil, err
+	}
+	var doc models.WorkAt
+	return &doc, decodeDocument(updated, &doc)
+}
+
+// Move holds the lock during both writes,
+// so nobody sees the user without the current employment
+func (r *memoryEmploymentRepository) Move(ctx context.Context, key string, next models.WorkAt) (*models.WorkAt, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if _, found := r.store.collections["work_at"][key]; !found {
+		return nil, ErrNotFound
+	}
+	err := r.checkOverlap(next.From, next.To, next.Since, next.Until, "")
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.store.patch("work_at", key, "", map[string]interface{}{
+		"until": next.Since,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.insert(next)
+}
+
+func (r *memoryEmploymentRepository) Erase(ctx context.Context, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if _, found := r.store.collections["work_at"][key]; !found {
+		return ErrNotFound
+	}
+	delete(r.store.collections["work_at"], key)
+	return nil
+}
+
+func (r *memoryEmploymentRepository) RemoveDangling(ctx context.Context) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	edges := r.edges(func(edge map[string]interface{}) bool {
+		return r.vertex(edge["_from"].(string)) == nil || r.vertex(edge["_to"].(string)) == nil
+	})
+	for _, edge := range edges {
+		delete(r.store.collections["work_at"], edge["_key"].(string))
+	}
+	return len(edges), nil
+}
+
+func (r *memoryEmploymentRepository) insert(edge models.WorkAt) (*models.WorkAt, error) {
+	data := map[string]interface{}{}
+	err := decodeDocument(edge, &data)
+	if err != nil {
+		return nil, err
+	}
+	created, err := r.store.insert("work_at", data)
+	if err != nil {
+		return nil, err
+	}
+	var doc models.WorkAt
+	return &doc, decodeDocument(created, &doc)
+}
+
+// the same as the overlap query of ArangoDB
+func (r *memoryEmploymentRepository) checkOverlap(from string, to string, since time.Time, until *time.Time, exceptKey string) error {
+	edges := r.edges(func(edge map[string]interface{}) bool {
+		if edge["_from"] != from || edge["_to"] != to || edge["_key"] == exceptKey {
+			return false
+		}
+		edgeSince, _ := parseTime(edge["since"])
+		edgeUntil, ended := parseTime(edge["until"])
+		return (!ended || edgeUntil.After(since)) && (until == nil || edgeSince.Before(*until))
+	})
+	if len(edges) > 0 {
+		return ErrOverlapped
+	}
+	return nil
+}
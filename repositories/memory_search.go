@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode"
+
+	"groupware-gin/models"
+)
+
+type memorySearchRepository struct {
+	store *MemoryStore
+}
+
+func (m *MemoryStore) Search() SearchRepository {
+	return &memorySearchRepository{store: m}
+}
+
+// searchWords splits the text in lower case like the analyzer of the view
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Search matches every word exactly or as a prefix, without the typos of ArangoDB,
+// and scores the exact matches higher
+func (r *memorySearchRepository) Search(ctx context.Context, options SearchOptions) ([]models.SearchResult, int64, error) {
+	tokens := searchWords(options.Query)
+	if len(tokens) == 0 {
+		return []models.SearchResult{}, 0, nil
+	}
+	type match struct {
+		kind  string
+		score float64
+		doc   map[string]interface{}
+	}
+	matches := []match{}
+	r.store.mu.Lock()
+	for _, collection := range []struct{ name, kind string }{{"users", "user"}, {"companies", "company"}} {
+		if options.Type != "" && options.Type != collection.kind {
+			continue
+		}
+		for _, doc := range r.store.collections[collection.name] {
+			if doc["deleted_at"] != nil {
+				continue
+			}
+			words := append(searchWords(stringValue(doc["name"])), searchWords(stringValue(doc["email"]))...)
+			score := 0.0
+			for _, token := range tokens {
+				best := 0.0
+				for _, word := range words {
+					if word == token {
+						best = 1
+					} else if strings.HasPrefix(word, token) && best == 0 {
+						best = 0.5
+					}
+				}
+				if best == 0 {
+					score = 0
+					break
+				}
+				score += best
+			}
+			if score > 0 {
+				doc := copyDocument(doc)
+				delete(doc, "password")
+				matches = append(matches, match{collection.kind, score, doc})
+			}
+		}
+	}
+	r.store.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return compareValues(matches[i].doc["_id"], matches[j].doc["_id"]) < 0
+	})
+	total := int64(len(matches))
+	start := options.Offset
+	if start > len(matches) {
+		start = len(matches)
+	}
+	end := start + options.Limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+	results := []models.SearchResult{}
+	for _, item := range matches[start:end] {
+		result, err := searchResult(item.kind, item.score, item.doc)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, result)
+	}
+	return results, total, nil
+}
@@ -0,0 +1,414 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"groupware-gin/models"
+)
+
+// the memory store stands for ArangoDB in the tests of the controllers,
+// so these tests pin the behaviors that the Arango repositories have
+
+func newCompanies(t *testing.T, names ...string) (*MemoryStore, CompanyRepository, []*models.Company) {
+	t.Helper()
+	m := NewMemoryStore()
+	companies := m.Companies()
+	created := []*models.Company{}
+	for i, name := range names {
+		company, err := companies.Create(context.Background(), models.Company{
+			Name:  name,
+			Since: time.Date(2000+i, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, company)
+	}
+	return m, companies, created
+}
+
+func companyNames(companies []models.Company) []string {
+	names := []string{}
+	for _, company := range companies {
+		names = append(names, company.Name)
+	}
+	return names
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryCreate(t *testing.T) {
+	ctx := context.Background()
+	_, companies, created := newCompanies(t, "Acme")
+	acme := created[0]
+	if acme.Key == "" || acme.Rev == "" || string(acme.ID) != "companies/"+acme.Key {
+		t.Errorf("got %+v", acme)
+	}
+	if acme.CreatedAt.IsZero() || !acme.UpdatedAt.Equal(acme.CreatedAt) || acme.DeletedAt != nil {
+		t.Errorf("got the times %+v", acme)
+	}
+
+	found, err := companies.Get(ctx, acme.Key)
+	if err != nil || found.Name != "Acme" || found.Rev != acme.Rev || !found.Since.Equal(acme.Since) {
+		t.Errorf("got %+v, %v", found, err)
+	}
+	_, err = companies.Get(ctx, "missing")
+	if err != ErrNotFound {
+		t.Errorf("got %v for a missing company", err)
+	}
+
+	// the same as the unique indexes, the names ignore the case
+	for _, name := range []string{"Acme", "acme", "ACME"} {
+		_, err = companies.Create(ctx, models.Company{Name: name})
+		if err != ErrConflict {
+			t.Errorf("got %v for the name %q", err, name)
+		}
+	}
+	users := NewMemoryStore().Users()
+	_, err = users.Create(ctx, models.User{Name: "Alice", Email: "alice@example.com"}, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.Create(ctx, models.User{Name: "Other Alice", Email: "alice@example.com"}, "hash")
+	if err != ErrConflict {
+		t.Errorf("got %v for the same email", err)
+	}
+}
+
+func TestMemoryRevision(t *testing.T) {
+	ctx := context.Background()
+	_, companies, created := newCompanies(t, "Acme", "Globex")
+	acme := created[0]
+	name := "Acme Corp"
+
+	updated, err := companies.Update(ctx, acme.Key, acme.Rev, CompanyPatch{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Rev == acme.Rev || updated.Name != name || updated.UpdatedAt.Before(acme.UpdatedAt) {
+		t.Errorf("got %+v after %+v", updated, acme)
+	}
+
+	// every write with the old revision fails, and changes nothing
+	stale := acme.Rev
+	_, err = companies.Update(ctx, acme.Key, stale, CompanyPatch{Name: &name})
+	if err != ErrPreconditionFailed {
+		t.Errorf("Update returned %v", err)
+	}
+	_, err = companies.Trash(ctx, acme.Key, stale)
+	if err != ErrPreconditionFailed {
+		t.Errorf("Trash returned %v", err)
+	}
+	_, err = companies.Restore(ctx, acme.Key, stale)
+	if err != ErrPreconditionFailed {
+		t.Errorf("Restore returned %v", err)
+	}
+	_, err = companies.Erase(ctx, acme.Key, stale, CascadeDelete)
+	if err != ErrPreconditionFailed {
+		t.Errorf("Erase returned %v", err)
+	}
+	found, _ := companies.Get(ctx, acme.Key)
+	if found.Rev != updated.Rev || found.DeletedAt != nil {
+		t.Errorf("the document is changed: %+v", found)
+	}
+
+	// an empty revision matches any
+	_, err = companies.Update(ctx, acme.Key, "", CompanyPatch{Name: &name})
+	if err != nil {
+		t.Errorf("Update without revision returned %v", err)
+	}
+
+	// the unique name is checked on update too
+	globex := "GLOBEX"
+	_, err = companies.Update(ctx, acme.Key, "", CompanyPatch{Name: &globex})
+	if err != ErrConflict {
+		t.Errorf("Update to the used name returned %v", err)
+	}
+	_, err = companies.Update(ctx, "missing", "", CompanyPatch{Name: &name})
+	if err != ErrNotFound {
+		t.Errorf("Update of a missing company returned %v", err)
+	}
+}
+
+func TestMemorySoftDelete(t *testing.T) {
+	ctx := context.Background()
+	_, companies, created := newCompanies(t, "Acme", "Globex")
+	acme := created[0]
+
+	trashed, err := companies.Trash(ctx, acme.Key, acme.Rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trashed.DeletedAt == nil || !trashed.UpdatedAt.Equal(*trashed.DeletedAt) || trashed.Rev == acme.Rev {
+		t.Errorf("got %+v", trashed)
+	}
+
+	for _, test := range []struct {
+		options ListOptions
+		want    []string
+	}{
+		{ListOptions{Limit: 10}, []string{"Globex"}},
+		{ListOptions{Limit: 10, WithTrashed: true}, []string{"Acme", "Globex"}},
+		{ListOptions{Limit: 10, OnlyTrashed: true}, []string{"Acme"}},
+	} {
+		list, total, err := companies.List(ctx, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := companyNames(list); !equalStrings(got, test.want) || total != int64(len(test.want)) {
+			t.Errorf("got %v of %d by %+v, want %v", got, total, test.options, test.want)
+		}
+	}
+
+	// Get returns the trashed one too
+	found, err := companies.Get(ctx, acme.Key)
+	if err != nil || found.DeletedAt == nil {
+		t.Errorf("got %+v, %v", found, err)
+	}
+
+	restored, err := companies.Restore(ctx, acme.Key, trashed.Rev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt != nil || restored.UpdatedAt.Before(*trashed.DeletedAt) {
+		t.Errorf("got %+v", restored)
+	}
+}
+
+func TestMemoryListFilter(t *testing.T) {
+	ctx := context.Background()
+	_, companies, _ := newCompanies(t, "Acme", "Globex", "Initech", "Hooli")
+
+	since := func(year int) time.Time {
+		return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	for _, test := range []struct {
+		condition Condition
+		want      []string
+	}{
+		{Condition{"name", "eq", "Globex"}, []string{"Globex"}},
+		{Condition{"name", "eq", "globex"}, []string{}},
+		{Condition{"name", "ne", "Globex"}, []string{"Acme", "Initech", "Hooli"}},
+		{Condition{"name", "in", []string{"Acme", "Hooli", "Wayne"}}, []string{"Acme", "Hooli"}},
+		{Condition{"name", "contains", "O"}, []string{"Globex", "Hooli"}},
+		{Condition{"name", "starts_with", "IN"}, []string{"Initech"}},
+		{Condition{"name", "ends_with", "ME"}, []string{"Acme"}},
+		{Condition{"since", "eq", since(2001)}, []string{"Globex"}},
+		{Condition{"since", "ne", since(2001)}, []string{"Acme", "Initech", "Hooli"}},
+		{Condition{"since", "gt", since(2001)}, []string{"Initech", "Hooli"}},
+		{Condition{"since", "gte", since(2001)}, []string{"Globex", "Initech", "Hooli"}},
+		{Condition{"since", "lt", since(2001)}, []string{"Acme"}},
+		{Condition{"since", "lte", since(2001)}, []string{"Acme", "Globex"}},
+		// a missing field is null, that is not equal to any date
+		{Condition{"deleted_at", "ne", since(2001)}, []string{"Acme", "Globex", "Initech", "Hooli"}},
+		{Condition{"deleted_at", "lt", since(2001)}, []string{}},
+	} {
+		list, total, err := companies.List(ctx, ListOptions{
+			Filter: []Condition{test.condition},
+			Limit:  10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := companyNames(list); !equalStrings(got, test.want) || total != int64(len(test.want)) {
+			t.Errorf("got %v by %+v, want %v", got, test.condition, test.want)
+		}
+	}
+
+	// the conditions and the search are combined with AND
+	list, _, err := companies.List(ctx, ListOptions{
+		Search: "o",
+		Filter: []Condition{{"since", "gt", since(2001)}},
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := companyNames(list); !equalStrings(got, []string{"Hooli"}) {
+		t.Errorf("got %v by search and filter", got)
+	}
+}
+
+func TestMemoryListSort(t *testing.T) {
+	ctx := context.Background()
+	m, companies, _ := newCompanies(t, "Acme", "Globex", "Initech")
+	// the same since as Globex, so _key breaks the tie
+	_, err := m.Insert("companies", map[string]interface{}{
+		"name":  "Hooli",
+		"since": time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		sort []SortKey
+		want []string
+	}{
+		{nil, []string{"Acme", "Globex", "Initech", "Hooli"}}, // by _key
+		{[]SortKey{{Field: "name"}}, []string{"Acme", "Globex", "Hooli", "Initech"}},
+		{[]SortKey{{Field: "name", Desc: true}}, []string{"Initech", "Hooli", "Globex", "Acme"}},
+		{[]SortKey{{Field: "since", Desc: true}}, []string{"Initech", "Globex", "Hooli", "Acme"}},
+	} {
+		list, _, err := companies.List(ctx, ListOptions{Sort: test.sort, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := companyNames(list); !equalStrings(got, test.want) {
+			t.Errorf("got %v by %+v, want %v", got, test.sort, test.want)
+		}
+	}
+
+	// the pages are cut after sorting, and the total ignores them
+	list, total, err := companies.List(ctx, ListOptions{Sort: []SortKey{{Field: "name"}}, Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := companyNames(list); !equalStrings(got, []string{"Globex", "Hooli"}) || total != 4 {
+		t.Errorf("got %v of %d", got, total)
+	}
+	list, _, _ = companies.List(ctx, ListOptions{Offset: 10, Limit: 2})
+	if len(list) != 0 {
+		t.Errorf("got %v after the end", companyNames(list))
+	}
+}
+
+func TestMemoryErase(t *testing.T) {
+	ctx := context.Background()
+	m, companies, created := newCompanies(t, "Acme", "Globex", "Initech")
+	employment := m.Employment()
+	for i, company := range created {
+		_, err := employment.Create(ctx, models.WorkAt{
+			From:  "users/alice",
+			To:    "companies/" + company.Key,
+			Since: time.Date(2020+i, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := companies.Erase(ctx, created[0].Key, "", CascadeBlock)
+	if err != ErrHasEmployment {
+		t.Errorf("block returned %v", err)
+	}
+
+	count, err := companies.Erase(ctx, created[0].Key, "", CascadeDelete)
+	if err != nil || count != 1 {
+		t.Errorf("delete returned %d, %v", count, err)
+	}
+	if _, err := companies.Get(ctx, created[0].Key); err != ErrNotFound {
+		t.Errorf("the company is kept: %v", err)
+	}
+
+	count, err = companies.Erase(ctx, created[1].Key, "", CascadeTrash)
+	if err != nil || count != 1 {
+		t.Errorf("trash returned %d, %v", count, err)
+	}
+	trashed, _ := companies.Get(ctx, created[1].Key)
+	if trashed == nil || trashed.DeletedAt == nil {
+		t.Errorf("the company is not trashed: %+v", trashed)
+	}
+	if _, err := employment.Current(ctx, "alice", created[1].Key); err != ErrNotFound {
+		t.Errorf("the employment is not ended: %v", err)
+	}
+	if len(m.Documents("work_at")) != 2 {
+		t.Errorf("got the edges %v", m.Documents("work_at"))
+	}
+
+	_, err = companies.Erase(ctx, "missing", "", CascadeDelete)
+	if err != ErrNotFound {
+		t.Errorf("erase of a missing company returned %v", err)
+	}
+}
+
+func TestMemoryEmploymentOverlap(t *testing.T) {
+	ctx := context.Background()
+	employment := NewMemoryStore().Employment()
+	date := func(year int) *time.Time {
+		t := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	create := func(since int, until *time.Time) (*models.WorkAt, error) {
+		return employment.Create(ctx, models.WorkAt{
+			From:  "users/alice",
+			To:    "companies/acme",
+			Since: *date(since),
+			Until: until,
+		})
+	}
+
+	past, err := create(2010, date(2015))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		since int
+		until *time.Time
+		err   error
+	}{
+		{2012, date(2013), ErrOverlapped},
+		{2005, date(2011), ErrOverlapped},
+		{2005, nil, ErrOverlapped},
+		{2005, date(2010), nil}, // ends when the other starts
+		{2015, nil, nil},        // starts when the other ends
+	} {
+		_, err := create(test.since, test.until)
+		if err != test.err {
+			t.Errorf("got %v for %d-%v, want %v", err, test.since, test.until, test.err)
+		}
+	}
+
+	// the edge does not overlap itself
+	_, err = employment.Update(ctx, past.Key, WorkAtPatch{Since: date(2011)})
+	if err != nil {
+		t.Errorf("Update returned %v", err)
+	}
+	_, err = employment.Update(ctx, past.Key, WorkAtPatch{Until: date(2016)})
+	if err != ErrOverlapped {
+		t.Errorf("Update into the next one returned %v", err)
+	}
+}
+
+func TestMemoryTokenReplace(t *testing.T) {
+	ctx := context.Background()
+	tokens := NewMemoryStore().RefreshTokens()
+	err := tokens.Create(ctx, models.RefreshToken{Key: "first", Family: "family", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tokens.Replace(ctx, "first", "second")
+	if err != nil {
+		t.Fatalf("Replace returned %v", err)
+	}
+	// the second use of the same token loses, like the conditional update of AQL
+	err = tokens.Replace(ctx, "first", "third")
+	if err != ErrConflict {
+		t.Errorf("Replace of the used token returned %v", err)
+	}
+	token, _ := tokens.Get(ctx, "first")
+	if token == nil || token.ReplacedBy != "second" {
+		t.Errorf("got %+v", token)
+	}
+
+	err = tokens.RevokeFamily(ctx, "family")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Get(ctx, "first"); err != ErrNotFound {
+		t.Errorf("the revoked token is kept: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+
+	"groupware-gin/models"
+)
+
+type memoryTokenRepository struct {
+	store *MemoryStore
+}
+
+func (m *MemoryStore) RefreshTokens() TokenRepository {
+	return &memoryTokenRepository{store: m}
+}
+
+func (r *memoryTokenRepository) Get(ctx context.Context, key string) (*models.RefreshToken, error) {
+	found, err := r.store.Document("refresh_tokens", key)
+	if err != nil {
+		return nil, err
+	}
+	var doc models.RefreshToken
+	return &doc, decodeDocument(found, &doc)
+}
+
+func (r *memoryTokenRepository) Create(ctx context.Context, token models.RefreshToken) error {
+	data := map[string]interface{}{}
+	err := decodeDocument(token, &data)
+	if err != nil {
+		return err
+	}
+	_, err = r.store.Insert("refresh_tokens", data)
+	return err
+}
+
+func (r *memoryTokenRepository) Replace(ctx context.Context, key string, next string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	doc, found := r.store.collections["refresh_tokens"][key]
+	if !found || doc["replaced_by"] != nil {
+		return ErrConflict
+	}
+	_, err := r.store.patch("refresh_tokens", key, "", map[string]interface{}{
+		"replaced_by": next,
+	})
+	return err
+}
+
+func (r *memoryTokenRepository) Delete(ctx context.Context, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if _, found := r.store.collections["refresh_tokens"][key]; !found {
+		return ErrNotFound
+	}
+	delete(r.store.collections["refresh_tokens"], key)
+	return nil
+}
+
+func (r *memoryTokenRepository) RevokeFamily(ctx context.Context, family string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	for key, doc := range r.store.collections["refresh_tokens"] {
+		if doc["family"] == family {
+			delete(r.store.collections["refresh_tokens"], key)
+		}
+	}
+	return nil
+}
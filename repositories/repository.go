@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"groupware-gin/models"
+)
+
+var (
+	ErrNotFound           = errors.New("this document does not exist")
+	ErrConflict           = errors.New("this document conflicts with another one")
+	ErrPreconditionFailed = errors.New("this document has been changed by another request")
+	ErrHasEmployment      = errors.New("this document still has employments, erase them or use other cascade")
+	ErrOverlapped         = errors.New("this employment overlaps another one at the same company")
+)
+
+// what happens to the work_at edges when a user or company is erased
+//
+//   - block: refuse to erase while any edge exists
+//   - delete: remove the edges with the vertex
+//   - trash: trash the vertex instead of erasing it and end its current employments,
+//     so the purger erases all of them together later
+const (
+	CascadeBlock  = "block"
+	CascadeDelete = "delete"
+	CascadeTrash  = "trash"
+)
+
+// Condition is a validated leaf of the filter,
+// all conditions are combined with AND
+type Condition struct {
+	Field    string
+	Operator string
+	Value    interface{} // string, []string or time.Time
+}
+
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ListOptions selects a page of a list,
+// the fields of conditions and sort keys must be validated by the caller
+type ListOptions struct {
+	Search      string
+	Filter      []Condition
+	Sort        []SortKey // _key is always the last key
+	Offset      int
+	Limit       int
+	WithTrashed bool
+	OnlyTrashed bool
+}
+
+// the employments to find by their period
+const (
+	WorkAtCurrent = "current"
+	WorkAtPast    = "past"
+	WorkAtAll     = "all"
+)
+
+// SearchOptions selects a page of the search result
+type SearchOptions struct {
+	Query  string // the words to find
+	Type   string // user or company, or empty for both
+	Offset int
+	Limit  int
+}
+
+// nil fields are kept as they are
+type CompanyPatch struct {
+	Name  *string
+	Since *time.Time
+}
+
+// nil fields are kept as they are
+type UserPatch struct {
+	Name       *string
+	Email      *string
+	Password   *string // hashed
+	Role       *string
+	Avatar     *string
+	Thumbnails map[string]string // replaces all thumbnails
+}
+
+// nil fields are kept as they are
+type WorkAtPatch struct {
+	Since    *time.Time
+	Until    *time.Time
+	Position *string
+	Role     *string
+}
+
+// both repositories return ErrNotFound for a missing document,
+// and Get returns trashed documents too.
+// the writes with a non-empty rev return ErrPreconditionFailed
+// unless the document still has the revision.
+
+type CompanyRepository interface {
+	List(ctx context.Context, options ListOptions) ([]models.Company, int64, error)
+	Get(ctx context.Context, key string) (*models.Company, error)
+	Create(ctx context.Context, company models.Company) (*models.Company, error)
+	Update(ctx context.Context, key string, rev string, patch CompanyPatch) (*models.Company, error)
+	Trash(ctx context.Context, key string, rev string) (*models.Company, error)
+	Restore(ctx context.Context, key string, rev string) (*models.Company, error)
+	// Erase returns the number of the affected edges
+	Erase(ctx context.Context, key string, rev string, cascade string) (int, error)
+}
+
+type UserRepository interface {
+	List(ctx context.Context, options ListOptions) ([]models.User, int64, error)
+	Get(ctx context.Context, key string) (*models.User, error)
+	Create(ctx context.Context, user models.User, password string) (*models.User, error)
+	Update(ctx context.Context, key string, rev string, patch UserPatch) (*models.User, error)
+	Trash(ctx context.Context, key string, rev string) (*models.User, error)
+	Restore(ctx context.Context, key string, rev string) (*models.User, error)
+	Erase(ctx context.Context, key string, rev string, cascade string) (int, error)
+	// Password returns the hashed password
+	Password(ctx context.Context, key string) (string, error)
+}
+
+// EmploymentRepository keeps the work_at edges and traverses the employment graph.
+// the writes return ErrOverlapped when the period overlaps
+// another edge between the same user and company.
+type EmploymentRepository interface {
+	Employees(ctx context.Context, companyKey string, status string) ([]models.Employee, error)
+	// Employers returns the past ones before the current one
+	Employers(ctx context.Context, userKey string, status string) ([]models.Employer, error)
+	Colleagues(ctx context.Context, userKey string) ([]models.Colleague, error)
+	// Connections returns the users reachable in depth links with the shortest path to each
+	Connections(ctx context.Context, userKey string, depth int) ([]models.Connection, error)
+	// Current returns ErrNotFound unless the user works at the company now
+	Current(ctx context.Context, userKey string, companyKey string) (*models.WorkAt, error)
+	IsCompanyAdmin(ctx context.Context, userKey string, companyKey string) (bool, error)
+	Create(ctx context.Context, edge models.WorkAt) (*models.WorkAt, error)
+	Update(ctx context.Context, key string, patch WorkAtPatch) (*models.WorkAt, error)
+	// Move ends the edge when the next one starts
+	Move(ctx context.Context, key string, next models.WorkAt) (*models.WorkAt, error)
+	Erase(ctx context.Context, key string) error
+	// RemoveDangling removes the edges to the missing vertices and returns the number of them
+	RemoveDangling(ctx context.Context) (int, error)
+}
+
+// TokenRepository keeps the refresh tokens by the hash as the key
+type TokenRepository interface {
+	Get(ctx context.Context, key string) (*models.RefreshToken, error)
+	Create(ctx context.Context, token models.RefreshToken) error
+	// Replace marks the token as used by the next one,
+	// or returns ErrConflict if it was used already
+	Replace(ctx context.Context, key string, next string) error
+	Delete(ctx context.Context, key string) error
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+// SearchRepository finds users and companies together, ranked by relevance
+type SearchRepository interface {
+	Search(ctx context.Context, options SearchOptions) ([]models.SearchResult, int64, error)
+}
+
+// documentCollection has the common operations of the user and company repositories,
+// that decode documents into the given pointer
+type documentCollection interface {
+	list(ctx context.Context, options ListOptions, docs interface{}) (int64, error)
+	get(ctx context.Context, key string, doc interface{}) error
+	create(ctx context.Context, data map[string]interface{}, doc interface{}) error
+	update(ctx context.Context, key string, rev string, data map[string]interface{}, doc interface{}) error
+	trash(ctx context.Context, key string, rev string, doc interface{}) error
+	restore(ctx context.Context, key string, rev string, doc interface{}) error
+	erase(ctx context.Context, key string, rev string, cascade string) (int, error)
+}
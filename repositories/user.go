@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+
+	"groupware-gin/models"
+)
+
+type userRepository struct {
+	collection documentCollection
+}
+
+func (r *userRepository) List(ctx context.Context, options ListOptions) ([]models.User, int64, error) {
+	users := []models.User{}
+	total, err := r.collection.list(ctx, options, &users)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *userRepository) Get(ctx context.Context, key string) (*models.User, error) {
+	var doc models.User
+	err := r.collection.get(ctx, key, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *userRepository) Create(ctx context.Context, user models.User, password string) (*models.User, error) {
+	var doc models.User
+	err := r.collection.create(ctx, map[string]interface{}{
+		"name":     user.Name,
+		"email":    strings.ToLower(user.Email), // unique regardless of the case
+		"password": password,
+		"role":     user.Role,
+		"avatar":   user.Avatar,
+	}, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *userRepository) Update(ctx context.Context, key string, rev string, patch UserPatch) (*models.User, error) {
+	data := map[string]interface{}{}
+	if patch.Name != nil {
+		data["name"] = *patch.Name
+	}
+	if patch.Email != nil {
+		data["email"] = strings.ToLower(*patch.Email)
+	}
+	if patch.Password != nil {
+		data["password"] = *patch.Password
+	}
+	if patch.Role != nil {
+		data["role"] = *patch.Role
+	}
+	if patch.Avatar != nil {
+		data["avatar"] = *patch.Avatar
+	}
+	if patch.Thumbnails != nil {
+		data["thumbnails"] = patch.Thumbnails
+	}
+	var doc models.User
+	err := r.collection.update(ctx, key, rev, data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *userRepository) Trash(ctx context.Context, key string, rev string) (*models.User, error) {
+	var doc models.User
+	err := r.collection.trash(ctx, key, rev, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *userRepository) Restore(ctx context.Context, key string, rev string) (*models.User, error) {
+	var doc models.User
+	err := r.collection.restore(ctx, key, rev, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+func (r *userRepository) Erase(ctx context.Context, key string, rev string, cascade string) (int, error) {
+	return r.collection.erase(ctx, key, rev, cascade)
+}
+
+func (r *userRepository) Password(ctx context.Context, key string) (string, error) {
+	var doc struct {
+		Password string `json:"password"`
+	}
+	err := r.collection.get(ctx, key, &doc)
+	if err != nil {
+		return "", err
+	}
+	return doc.Password, nil
+}
@@ -3,9 +3,9 @@ package seeds
 import (
 	"context"
 	"math"
+	"strings"
 	"time"
 
-	driver "github.com/arangodb/go-driver"
 	"github.com/gin-gonic/gin"
 	"syreclabs.com/go/faker"
 
@@ -21,24 +21,13 @@ func InstallCompanies() error {
 		return err
 	}
 
-	// at the first, clean up old collection
-	found, err := db.CollectionExists(ctx, "companies")
+	// at the first, clean up old documents,
+	// the collection is created by the migrations
+	col, err := db.Collection(ctx, "companies")
 	if err != nil {
 		return err
 	}
-	if found {
-		col, err := db.Collection(ctx, "companies")
-		if err != nil {
-			return err
-		}
-		col.Remove(ctx)
-	}
-
-	// create new collection
-	options := &driver.CreateCollectionOptions{
-		Type: driver.CollectionTypeDocument,
-	}
-	col, err := db.CreateCollection(ctx, "companies", options)
+	err = col.Truncate(ctx)
 	if err != nil {
 		return err
 	}
@@ -46,8 +35,10 @@ func InstallCompanies() error {
 	// create a few companies in this collection
 	for i := 0; i < 10; i++ {
 		now := time.Now().UTC()
+		name := faker.Company().Name()
 		_, err := col.CreateDocument(ctx, gin.H{
-			"name":       faker.Company().Name(),
+			"name":       name,
+			"name_lower": strings.ToLower(name), // for the unique index
 			"since":      faker.Date().Backward(time.Duration(math.Pow10(9) * 3600 * 24 * 365 * 10)).UTC(),
 			"created_at": now,
 			"updated_at": now,
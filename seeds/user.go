@@ -2,13 +2,10 @@ package seeds
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
-	"io"
 	"math"
 	netHttp "net/http"
-	"os"
+	"strings"
 	"time"
 
 	driver "github.com/arangodb/go-driver"
@@ -16,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"syreclabs.com/go/faker"
 
+	"groupware-gin/blobs"
 	"groupware-gin/helpers"
 	"groupware-gin/models"
 )
@@ -23,8 +21,12 @@ import (
 func InstallUsers() error {
 	ctx := context.Background()
 
-	// remove the existing user avatars from local disk
-	err := os.RemoveAll("storage/users")
+	// remove the existing user avatars from the storage
+	store, err := blobs.NewBlobStore()
+	if err != nil {
+		return err
+	}
+	err = store.DeletePrefix(ctx, "users")
 	if err != nil {
 		return err
 	}
@@ -35,80 +37,41 @@ func InstallUsers() error {
 		return err
 	}
 
-	// at the first, clean up old collection
-	found, err := db.CollectionExists(ctx, "users")
+	// at the first, clean up old documents,
+	// the collections and the graph are created by the migrations
+	usersCollection, err := db.Collection(ctx, "users")
 	if err != nil {
 		return err
 	}
-	if found {
-		usersCollection, err := db.Collection(ctx, "users")
-		if err != nil {
-			return err
-		}
-		usersCollection.Remove(ctx)
-	}
-	found, err = db.CollectionExists(ctx, "work_at")
+	err = usersCollection.Truncate(ctx)
 	if err != nil {
 		return err
 	}
-	if found {
-		workAtCollection, err := db.Collection(ctx, "work_at")
-		if err != nil {
-			return err
-		}
-		workAtCollection.Remove(ctx)
-	}
-	found, err = db.GraphExists(ctx, "employment")
+	workAtCollection, err := db.Collection(ctx, "work_at")
 	if err != nil {
 		return err
 	}
-	if found {
-		graph, err := db.Graph(ctx, "employment")
-		if err != nil {
-			return err
-		}
-		graph.Remove(ctx)
-	}
-
-	// create new collections
-	options := &driver.CreateCollectionOptions{
-		Type: driver.CollectionTypeDocument,
-	}
-	usersCollection, err := db.CreateCollection(ctx, "users", options)
+	err = workAtCollection.Truncate(ctx)
 	if err != nil {
 		return err
 	}
-	options = &driver.CreateCollectionOptions{
-		Type: driver.CollectionTypeEdge,
-	}
-	workAtCollection, err := db.CreateCollection(ctx, "work_at", options)
+
+	// create a few users about every company
+	query := "FOR x IN companies RETURN x"
+	cursor, err := db.Query(ctx, query, nil)
 	if err != nil {
 		return err
 	}
-
-	// create new graph
-	edgeDef := driver.EdgeDefinition{
-		Collection: "work_at",
-		From:       []string{"users"},
-		To:         []string{"companies"},
-	}
-	graphGptions := &driver.CreateGraphOptions{
-		EdgeDefinitions: []driver.EdgeDefinition{edgeDef},
-	}
-	_, err = db.CreateGraph(ctx, "employment", graphGptions)
+	defer cursor.Close()
+	hasher, err := helpers.NewPasswordHasher()
 	if err != nil {
 		return err
 	}
-
-	// create a few users about every company
-	query := "FOR x IN companies RETURN x"
-	cursor, err := db.Query(ctx, query, nil)
+	pswd, err := hasher.Hash("123456")
 	if err != nil {
 		return err
 	}
-	defer cursor.Close()
-	hasher := md5.New()
-	pswd := []byte("123456")
+	first := true
 	for {
 		var company models.Company
 		companyMeta, err := cursor.ReadDocument(ctx, &company)
@@ -119,33 +82,44 @@ func InstallUsers() error {
 		}
 		count := faker.Number().NumberInt(1)
 		for i := 0; i < count; i++ {
+			// the first user is the system admin
+			role := models.RoleMember
+			if first {
+				role = models.RoleAdmin
+				first = false
+			}
+			now := time.Now().UTC()
 			userMeta, err := usersCollection.CreateDocument(ctx, gin.H{
-				"name":     faker.Name().Name(),
-				"email":    faker.Internet().Email(),
-				"password": hex.EncodeToString(hasher.Sum(pswd)),
+				"name":       faker.Name().Name(),
+				"email":      strings.ToLower(faker.Internet().Email()),
+				"password":   pswd,
+				"role":       role,
+				"created_at": now,
+				"updated_at": now,
 			})
 			if err != nil {
 				return err
 			}
 			// create the avatar
-			err = os.MkdirAll("storage/users/"+userMeta.Key, os.ModePerm)
-			if err != nil {
-				return err
-			}
-			fileName := uuid.New().String() + ".jpg"
-			filePath := "users/" + userMeta.Key + "/" + fileName
-			DownloadFile("https://thispersondoesnotexist.com/image", "storage/"+filePath)
+			filePath := "users/" + userMeta.Key + "/" + uuid.New().String() + ".jpg"
+			DownloadFile(ctx, store, "https://thispersondoesnotexist.com/image", filePath)
 			userMeta, err = usersCollection.UpdateDocument(ctx, userMeta.Key, gin.H{
-				"Avatar": filePath,
+				"avatar": filePath,
 			})
 			if err != nil {
 				return err
 			}
-			// register user to company
+			// register user to company, the first employee is the company admin
+			role = models.RoleMember
+			if i == 0 {
+				role = models.RoleAdmin
+			}
 			_, err = workAtCollection.CreateDocument(ctx, gin.H{
-				"from":  "users/" + userMeta.Key,
-				"to":    "companies/" + companyMeta.Key,
-				"since": faker.Date().Backward(time.Duration(math.Pow10(9) * 3600 * 24 * 365 * 10)),
+				"_from":    "users/" + userMeta.Key,
+				"_to":      "companies/" + companyMeta.Key,
+				"since":    faker.Date().Backward(time.Duration(math.Pow10(9) * 3600 * 24 * 365 * 10)).UTC(),
+				"position": faker.Name().Title(),
+				"role":     role,
 			})
 			if err != nil {
 				return err
@@ -156,29 +130,23 @@ func InstallUsers() error {
 	return nil
 }
 
-func DownloadFile(srcURL string, destPath string) error {
-	// create blink file
-	file, err := os.Create(destPath)
-	if err != nil {
-		return err
-	}
+func DownloadFile(ctx context.Context, store blobs.BlobStore, srcURL string, key string) error {
 	client := netHttp.Client{
 		CheckRedirect: func(req *netHttp.Request, via []*netHttp.Request) error {
 			req.URL.Opaque = req.URL.Path
 			return nil
 		},
 	}
-	// put content on file
+	// put content on the storage
 	resp, err := client.Get(srcURL)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	size, err := io.Copy(file, resp.Body)
+	err = store.Put(ctx, key, resp.Body, resp.ContentLength, "image/jpeg")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	fmt.Printf("Downloaded a file %s with size %d\n", destPath, size)
+	fmt.Printf("Downloaded a file %s with size %d\n", key, resp.ContentLength)
 	return nil
 }